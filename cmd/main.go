@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -16,9 +17,12 @@ import (
 	"tezos-delegation-service/db"
 	"tezos-delegation-service/internal/api"
 	"tezos-delegation-service/internal/config"
+	"tezos-delegation-service/internal/fixture"
+	"tezos-delegation-service/internal/leader"
 	"tezos-delegation-service/internal/poller"
 	"tezos-delegation-service/internal/store"
 	"tezos-delegation-service/internal/tzkt"
+	"tezos-delegation-service/internal/verify"
 )
 
 func main() {
@@ -48,22 +52,218 @@ func main() {
 		log.Fatalf("cannot ping db: %v", err)
 	}
 
-	delegationStore := store.NewDelegationStore(dbConn)
-	tzktClient := tzkt.NewClient(cfg.TzktBaseURL, cfg.HTTPClientTimeout)
-
-	p := poller.NewPoller(poller.Config{
-		Store:        delegationStore,
-		Client:       tzktClient,
-		BatchSize:    cfg.PollerBatchSize,
-		PollInterval: cfg.PollerInterval,
-		GenesisStart: time.Date(2018, 6, 30, 0, 0, 0, 0, time.UTC),
-		MaxBackoff:   2 * time.Minute,
-		Logger:       log.Default(),
-	})
+	if len(cfg.Networks) == 0 {
+		log.Fatalf("no network configured")
+	}
+
+	var serveAPI, ingest bool
+	switch cfg.RunMode {
+	case "combined":
+		serveAPI, ingest = true, true
+	case "api":
+		serveAPI = true
+	case "poller":
+		ingest = true
+	default:
+		log.Fatalf("unknown RUN_MODE %q, expected api, poller or combined", cfg.RunMode)
+	}
+
+	stores := make(map[string]store.DelegationStore, len(cfg.Networks))
+	stakingStores := make(map[string]store.StakingStore, len(cfg.Networks))
+	pollers := make(map[string]*poller.Poller, len(cfg.Networks))
+	stakingPollers := make(map[string]*poller.StakingPoller)
+	verifiers := make(map[string]*verify.Verifier)
+	reconcilers := make(map[string]*poller.Reconciler)
+	routerOpts := []api.Option{api.WithNetworks(stores)}
+	// statusOpts report on ingestion, in the /health and /metrics of the
+	// modes that run it.
+	var statusOpts []api.Option
+	for _, n := range cfg.Networks {
+		if _, ok := stores[n.Name]; ok {
+			log.Fatalf("network %q is configured twice", n.Name)
+		}
+
+		var (
+			client     tzkt.Client
+			subscriber tzkt.Subscriber
+		)
+		switch n.Source {
+		case "tzkt":
+			if len(n.TzktBaseURLs) == 0 {
+				log.Fatalf("network %q: no TzKT base URL configured", n.Name)
+			}
+			endpoints := tzkt.NewEndpoints(n.TzktBaseURLs...)
+			breaker := tzkt.NewBreaker(cfg.TzktBreakerThreshold, cfg.TzktBreakerCooldown)
+			limiter := tzkt.NewLimiter(cfg.TzktRateLimit, cfg.TzktRateBurst)
+			if cfg.TzktRateAdaptive {
+				limiter = tzkt.NewAdaptiveLimiter(cfg.TzktRateLimit, cfg.TzktRateBurst)
+			}
+			opts := []tzkt.Option{tzkt.WithBreaker(breaker), tzkt.WithLimiter(limiter), tzkt.WithEndpoints(endpoints)}
+			fixtures := filepath.Join(cfg.TzktFixturesDir, n.Name)
+			switch cfg.TzktFixtures {
+			case "":
+			case "record":
+				log.Printf("network %q: recording TzKT responses to %s", n.Name, fixtures)
+				opts = append(opts, tzkt.WithTransport(fixture.NewRecorder(fixtures, nil)))
+			case "replay":
+				log.Printf("network %q: replaying TzKT responses from %s", n.Name, fixtures)
+				opts = append(opts, tzkt.WithTransport(fixture.NewReplayer(fixtures)))
+			default:
+				log.Fatalf("unknown TZKT_FIXTURES mode %q, expected record or replay", cfg.TzktFixtures)
+			}
+			client = tzkt.NewClient(n.TzktBaseURLs[0], cfg.HTTPClientTimeout, opts...)
+			statusOpts = append(statusOpts, api.WithHealthCheck("tzkt_"+n.Name, func(context.Context) (string, error) {
+				if state := breaker.State(); state != tzkt.BreakerClosed {
+					return "", fmt.Errorf("circuit %s", state)
+				}
+				return "circuit closed", nil
+			}))
+			statusOpts = append(statusOpts,
+				api.WithHealthCheck("tzkt_"+n.Name+"_rate", func(context.Context) (string, error) {
+					return fmt.Sprintf("%.2f req/s", limiter.Rate()), nil
+				}),
+				api.WithHealthCheck("tzkt_"+n.Name+"_endpoints", func(context.Context) (string, error) {
+					healthy := 0
+					for _, s := range endpoints.Status() {
+						if s.Healthy {
+							healthy++
+						}
+					}
+					if healthy == 0 {
+						return "", fmt.Errorf("no healthy instance, using %s", endpoints.Current())
+					}
+					return fmt.Sprintf("using %s, %d/%d healthy", endpoints.Current(), healthy, len(n.TzktBaseURLs)), nil
+				}),
+				api.WithGauge(api.Gauge{
+					Name:   "tzkt_rate_limit_requests_per_second",
+					Help:   "Requests per second currently allowed to TzKT.",
+					Labels: map[string]string{"network": n.Name},
+					Value:  limiter.Rate,
+				}),
+			)
+			if cfg.TzktStream {
+				// The events hub stays on the preferred instance. While it is
+				// down the poller falls back to the client, which fails over.
+				subscriber = tzkt.NewSubscriber(n.TzktBaseURLs[0])
+			}
+		case "node":
+			if n.NodeRPCURL == "" {
+				log.Fatalf("network %q: no node RPC URL configured", n.Name)
+			}
+			client = tzkt.NewNodeClient(n.NodeRPCURL, cfg.HTTPClientTimeout)
+			if cfg.TzktStream {
+				log.Printf("network %q: TZKT_STREAM is ignored with the node source, polling instead", n.Name)
+			}
+		default:
+			log.Fatalf("network %q: unknown delegation source %q, expected tzkt or node", n.Name, n.Source)
+		}
+
+		stores[n.Name] = store.NewNetworkStore(dbConn, n.Name)
+		pollers[n.Name] = poller.NewPoller(poller.Config{
+			Store:               stores[n.Name],
+			Client:              client,
+			BatchSize:           cfg.PollerBatchSize,
+			ChunkSize:           cfg.PollerChunkSize,
+			PollInterval:        cfg.PollerInterval,
+			GenesisStart:        n.Genesis,
+			MaxBackoff:          2 * time.Minute,
+			ReorgWindow:         cfg.PollerReorgWindow,
+			BackfillWorkers:     cfg.BackfillWorkers,
+			BackfillRangeSize:   int64(cfg.BackfillRangeSize),
+			Subscriber:          subscriber,
+			StreamRetryInterval: cfg.StreamRetryInterval,
+			Logger:              log.New(log.Writer(), "["+n.Name+"] ", log.Flags()|log.Lmsgprefix),
+		})
 
+		p := pollers[n.Name]
+		statusOpts = append(statusOpts, api.WithHealthCheck("poller_"+n.Name, func(ctx context.Context) (string, error) {
+			state, err := p.SyncState(ctx)
+			if err != nil {
+				return "", err
+			}
+			if state.CursorID == 0 {
+				return "not synced yet", nil
+			}
+			return fmt.Sprintf("synced to level %d (%s)", state.Level, state.Timestamp.UTC().Format(time.RFC3339)), nil
+		}))
+
+		stakingStores[n.Name] = store.NewStakingStore(dbConn, n.Name)
+		if n.Source == "tzkt" && cfg.TzktStaking {
+			stakingPollers[n.Name] = poller.NewStakingPoller(poller.StakingConfig{
+				Store:         stakingStores[n.Name],
+				Client:        client,
+				BatchSize:     cfg.PollerBatchSize,
+				PollInterval:  cfg.PollerInterval,
+				MaxBackoff:    2 * time.Minute,
+				Confirmations: cfg.PollerReorgWindow,
+				Logger:        log.New(log.Writer(), "["+n.Name+"] ", log.Flags()|log.Lmsgprefix),
+			})
+		}
+
+		if n.Source == "tzkt" && cfg.ReconcileInterval > 0 {
+			reconcilers[n.Name] = poller.NewReconciler(poller.ReconcileConfig{
+				Store:         stores[n.Name],
+				Audit:         store.NewAuditStore(dbConn, n.Name),
+				Client:        client,
+				BatchSize:     cfg.PollerBatchSize,
+				RangeSize:     cfg.ReconcileRangeSize,
+				Interval:      cfg.ReconcileInterval,
+				Confirmations: cfg.PollerReorgWindow,
+				GenesisStart:  n.Genesis,
+				Logger:        log.New(log.Writer(), "["+n.Name+"] ", log.Flags()|log.Lmsgprefix),
+			})
+		}
+
+		if n.VerifyURL != "" {
+			source, err := verify.NewSource(n.VerifySource, n.VerifyURL, cfg.HTTPClientTimeout)
+			if err != nil {
+				log.Fatalf("network %q: %v", n.Name, err)
+			}
+			verifiers[n.Name] = verify.New(verify.Config{
+				Network:       n.Name,
+				Store:         store.NewAuditStore(dbConn, n.Name),
+				Source:        source,
+				CompareIDs:    n.VerifySource == "tzkt",
+				Samples:       cfg.VerifySamples,
+				RangeSize:     cfg.VerifyRangeSize,
+				Confirmations: int64(cfg.PollerReorgWindow),
+			})
+		}
+	}
+	routerOpts = append(routerOpts, api.WithStaking(stakingStores[cfg.Networks[0].Name], stakingStores))
+	switch {
+	case len(verifiers) > 0 && cfg.AdminToken == "":
+		log.Printf("ADMIN_TOKEN is not set, /admin/verify is disabled")
+	case len(verifiers) > 0:
+		routerOpts = append(routerOpts,
+			api.WithVerifiers(verifiers[cfg.Networks[0].Name], verifiers),
+			api.WithAdminToken(cfg.AdminToken),
+		)
+	}
+
+	// Only the elected leader ingests; every replica serves the API.
+	var elector *leader.Elector
+	if ingest && cfg.LeaderElection {
+		elector = leader.New(dbConn, leader.DefaultKey, leader.WithInterval(cfg.LeaderInterval))
+		statusOpts = append(statusOpts, api.WithHealthCheck("role", func(context.Context) (string, error) {
+			return elector.Role(), nil
+		}))
+	}
+
+	// The API serves the ingestion status too when both run in this process.
+	// A poller alone serves its status on a listener of its own.
+	addr, handler := cfg.HTTPAddr, http.Handler(nil)
+	switch {
+	case serveAPI && ingest:
+		handler = api.NewRouter(stores[cfg.Networks[0].Name], dbConn, append(routerOpts, statusOpts...)...)
+	case serveAPI:
+		handler = api.NewRouter(stores[cfg.Networks[0].Name], dbConn, routerOpts...)
+	default:
+		addr, handler = cfg.StatusAddr, api.NewStatusRouter(dbConn, statusOpts...)
+	}
 	srv := &http.Server{
-		Addr:         cfg.HTTPAddr,
-		Handler:      api.NewRouter(delegationStore, dbConn),
+		Addr:         addr,
+		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -72,20 +272,63 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	g, gCtx := errgroup.WithContext(ctx)
+	// runIngestion runs the pollers and reconcilers of every network until
+	// ctx is done.
+	runIngestion := func(ctx context.Context) error {
+		g, gCtx := errgroup.WithContext(ctx)
 
-	// Starting the poller in the background
-	g.Go(func() error {
-		log.Println("Starting poller...")
-		if err := p.Run(gCtx); err != nil {
-			return fmt.Errorf("poller error: %w", err)
+		// Starting one poller per network in the background
+		for name, p := range pollers {
+			g.Go(func() error {
+				log.Printf("Starting %s poller...", name)
+				if err := p.Run(gCtx); err != nil {
+					return fmt.Errorf("%s poller error: %w", name, err)
+				}
+				log.Printf("%s poller stopped gracefully", name)
+				return nil
+			})
 		}
-		log.Println("Poller stopped gracefully")
-		return nil
-	})
+		for name, p := range stakingPollers {
+			g.Go(func() error {
+				log.Printf("Starting %s staking poller...", name)
+				if err := p.Run(gCtx); err != nil {
+					return fmt.Errorf("%s staking poller error: %w", name, err)
+				}
+				log.Printf("%s staking poller stopped gracefully", name)
+				return nil
+			})
+		}
+
+		for name, r := range reconcilers {
+			g.Go(func() error {
+				log.Printf("Starting %s reconciler...", name)
+				if err := r.Run(gCtx); err != nil {
+					return fmt.Errorf("%s reconciler error: %w", name, err)
+				}
+				log.Printf("%s reconciler stopped gracefully", name)
+				return nil
+			})
+		}
+		return g.Wait()
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+
+	switch {
+	case !ingest:
+		log.Printf("Running in %s mode, not ingesting", cfg.RunMode)
+	case elector != nil:
+		g.Go(func() error {
+			return elector.Run(gCtx, runIngestion)
+		})
+	default:
+		g.Go(func() error {
+			return runIngestion(gCtx)
+		})
+	}
 
 	g.Go(func() error {
-		log.Printf("HTTP server listening on %s", cfg.HTTPAddr)
+		log.Printf("HTTP server listening on %s (%s mode)", addr, cfg.RunMode)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			return fmt.Errorf("http server error: %w", err)
 		}
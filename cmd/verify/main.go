@@ -0,0 +1,128 @@
+// Command verify checks the delegations stored for a network against a
+// second source, another TzKT instance or a Tezos node, and exits with status
+// 1 when they disagree. It is configured like the service, and its flags
+// override the verification settings.
+//
+//	VERIFY_URL=https://api.tzkt.io/v1 go run ./cmd/verify -samples 20
+//	go run ./cmd/verify -source node -url http://localhost:8732 -from 5000000 -to 5000100
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"tezos-delegation-service/db"
+	"tezos-delegation-service/internal/config"
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/verify"
+)
+
+func main() {
+	cfg := config.Load()
+	if len(cfg.Networks) == 0 {
+		log.Fatalf("no network configured")
+	}
+
+	network := flag.String("network", cfg.Networks[0].Name, "network to verify")
+	source := flag.String("source", "", "verification source, tzkt or node (default VERIFY_SOURCE)")
+	url := flag.String("url", "", "URL of the verification source (default VERIFY_URL)")
+	samples := flag.Int("samples", cfg.VerifySamples, "number of random level ranges to check")
+	rangeSize := flag.Int64("range", cfg.VerifyRangeSize, "number of levels per range")
+	from := flag.Int64("from", 0, "check the single range [from, to) instead of random samples")
+	to := flag.Int64("to", 0, "end of the range checked with -from, exclusive")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	var n *config.Network
+	for i := range cfg.Networks {
+		if cfg.Networks[i].Name == *network {
+			n = &cfg.Networks[i]
+		}
+	}
+	if n == nil {
+		log.Fatalf("network %q is not configured", *network)
+	}
+	if *source == "" {
+		*source = n.VerifySource
+	}
+	if *url == "" {
+		*url = n.VerifyURL
+	}
+	if *url == "" {
+		log.Fatalf("network %q: no verification source URL, set -url or VERIFY_URL", n.Name)
+	}
+	client, err := verify.NewSource(*source, *url, cfg.HTTPClientTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dbConn, err := db.New(cfg.DB_DSN)
+	if err != nil {
+		log.Fatalf("cannot open the db: %v", err)
+	}
+	defer dbConn.Close()
+
+	v := verify.New(verify.Config{
+		Network:       n.Name,
+		Store:         store.NewAuditStore(dbConn, n.Name),
+		Source:        client,
+		CompareIDs:    *source == "tzkt",
+		Samples:       *samples,
+		RangeSize:     *rangeSize,
+		Confirmations: int64(cfg.PollerReorgWindow),
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var report verify.Report
+	if *from > 0 || *to > 0 {
+		if *to <= *from {
+			log.Fatalf("-to must be greater than -from")
+		}
+		report, err = v.VerifyRanges(ctx, [2]int64{*from, *to})
+	} else {
+		report, err = v.Verify(ctx, *samples)
+	}
+	if err != nil {
+		log.Fatalf("verify: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func printReport(r verify.Report) {
+	stored, source := 0, 0
+	for _, rg := range r.Ranges {
+		fmt.Printf("levels [%d, %d): %d stored, %d at the source\n", rg.FromLevel, rg.ToLevel, rg.Stored, rg.Source)
+		stored += rg.Stored
+		source += rg.Source
+	}
+	for _, m := range r.Mismatches {
+		fmt.Printf("%s: level %d, delegator %s", m.Kind, m.Level, m.Delegator)
+		if m.Stored != nil {
+			fmt.Printf(", stored id %d amount %d %s", m.Stored.ID, m.Stored.Amount, m.Stored.Status)
+		}
+		if m.Source != nil {
+			fmt.Printf(", source id %d amount %d %s", m.Source.ID, m.Source.Amount, m.Source.Status)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%s: %d ranges, %d stored and %d source delegations, %d mismatches\n",
+		r.Network, len(r.Ranges), stored, source, len(r.Mismatches))
+}
@@ -0,0 +1,5 @@
+ALTER TABLE delegations
+    DROP COLUMN IF EXISTS previous_baker_alias,
+    DROP COLUMN IF EXISTS previous_baker,
+    DROP COLUMN IF EXISTS baker_alias,
+    DROP COLUMN IF EXISTS baker;
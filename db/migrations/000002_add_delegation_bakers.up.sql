@@ -0,0 +1,5 @@
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS baker TEXT,
+    ADD COLUMN IF NOT EXISTS baker_alias TEXT,
+    ADD COLUMN IF NOT EXISTS previous_baker TEXT,
+    ADD COLUMN IF NOT EXISTS previous_baker_alias TEXT;
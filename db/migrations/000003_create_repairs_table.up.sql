@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS repairs (
+    name TEXT PRIMARY KEY,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
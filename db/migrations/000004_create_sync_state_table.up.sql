@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS sync_state (
+    name TEXT PRIMARY KEY,
+    cursor_id BIGINT NOT NULL DEFAULT 0,
+    level BIGINT NOT NULL DEFAULT 0,
+    timestamp TIMESTAMPTZ,
+    batch_count BIGINT NOT NULL DEFAULT 0,
+    last_success_at TIMESTAMPTZ
+);
+
+-- Seed the delegations cursor from data ingested before the checkpoint existed.
+INSERT INTO sync_state (name, cursor_id, level, timestamp)
+SELECT 'delegations', tzkt_id, level, timestamp
+FROM delegations
+ORDER BY tzkt_id DESC
+LIMIT 1
+ON CONFLICT (name) DO NOTHING;
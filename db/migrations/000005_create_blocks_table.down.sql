@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_delegations_level;
+DROP TABLE IF EXISTS blocks;
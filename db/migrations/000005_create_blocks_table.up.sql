@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS blocks (
+    level BIGINT PRIMARY KEY,
+    hash TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_delegations_level
+    ON delegations (level);
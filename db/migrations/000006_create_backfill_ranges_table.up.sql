@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS backfill_ranges (
+    name TEXT NOT NULL,
+    from_level BIGINT NOT NULL,
+    to_level BIGINT NOT NULL,
+    cursor_id BIGINT NOT NULL DEFAULT 0,
+    done BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, from_level)
+);
@@ -0,0 +1,33 @@
+DELETE FROM repairs WHERE network <> 'mainnet';
+ALTER TABLE repairs DROP CONSTRAINT IF EXISTS repairs_pkey;
+ALTER TABLE repairs DROP COLUMN IF EXISTS network;
+ALTER TABLE repairs ADD PRIMARY KEY (name);
+
+DELETE FROM backfill_ranges WHERE network <> 'mainnet';
+ALTER TABLE backfill_ranges DROP CONSTRAINT IF EXISTS backfill_ranges_pkey;
+ALTER TABLE backfill_ranges DROP COLUMN IF EXISTS network;
+ALTER TABLE backfill_ranges ADD PRIMARY KEY (name, from_level);
+
+DELETE FROM blocks WHERE network <> 'mainnet';
+ALTER TABLE blocks DROP CONSTRAINT IF EXISTS blocks_pkey;
+ALTER TABLE blocks DROP COLUMN IF EXISTS network;
+ALTER TABLE blocks ADD PRIMARY KEY (level);
+
+DELETE FROM sync_state WHERE network <> 'mainnet';
+ALTER TABLE sync_state DROP CONSTRAINT IF EXISTS sync_state_pkey;
+ALTER TABLE sync_state DROP COLUMN IF EXISTS network;
+ALTER TABLE sync_state ADD PRIMARY KEY (name);
+
+DELETE FROM delegations WHERE network <> 'mainnet';
+DROP INDEX IF EXISTS idx_delegations_network_level;
+DROP INDEX IF EXISTS idx_delegations_network_year_timestamp_desc;
+DROP INDEX IF EXISTS idx_delegations_network_timestamp_desc;
+ALTER TABLE delegations DROP CONSTRAINT IF EXISTS delegations_network_tzkt_id_key;
+ALTER TABLE delegations DROP COLUMN IF EXISTS network;
+ALTER TABLE delegations ADD CONSTRAINT delegations_tzkt_id_key UNIQUE (tzkt_id);
+CREATE INDEX IF NOT EXISTS idx_delegations_timestamp_desc
+    ON delegations (timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_year_timestamp_desc
+    ON delegations (year, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_level
+    ON delegations (level);
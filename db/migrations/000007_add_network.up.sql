@@ -0,0 +1,30 @@
+-- Rows ingested before networks existed all come from mainnet.
+ALTER TABLE delegations ADD COLUMN IF NOT EXISTS network TEXT NOT NULL DEFAULT 'mainnet';
+ALTER TABLE delegations DROP CONSTRAINT IF EXISTS delegations_tzkt_id_key;
+ALTER TABLE delegations ADD CONSTRAINT delegations_network_tzkt_id_key UNIQUE (network, tzkt_id);
+
+DROP INDEX IF EXISTS idx_delegations_timestamp_desc;
+DROP INDEX IF EXISTS idx_delegations_year_timestamp_desc;
+DROP INDEX IF EXISTS idx_delegations_level;
+CREATE INDEX IF NOT EXISTS idx_delegations_network_timestamp_desc
+    ON delegations (network, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_year_timestamp_desc
+    ON delegations (network, year, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_level
+    ON delegations (network, level);
+
+ALTER TABLE sync_state ADD COLUMN IF NOT EXISTS network TEXT NOT NULL DEFAULT 'mainnet';
+ALTER TABLE sync_state DROP CONSTRAINT IF EXISTS sync_state_pkey;
+ALTER TABLE sync_state ADD PRIMARY KEY (network, name);
+
+ALTER TABLE blocks ADD COLUMN IF NOT EXISTS network TEXT NOT NULL DEFAULT 'mainnet';
+ALTER TABLE blocks DROP CONSTRAINT IF EXISTS blocks_pkey;
+ALTER TABLE blocks ADD PRIMARY KEY (network, level);
+
+ALTER TABLE backfill_ranges ADD COLUMN IF NOT EXISTS network TEXT NOT NULL DEFAULT 'mainnet';
+ALTER TABLE backfill_ranges DROP CONSTRAINT IF EXISTS backfill_ranges_pkey;
+ALTER TABLE backfill_ranges ADD PRIMARY KEY (network, name, from_level);
+
+ALTER TABLE repairs ADD COLUMN IF NOT EXISTS network TEXT NOT NULL DEFAULT 'mainnet';
+ALTER TABLE repairs DROP CONSTRAINT IF EXISTS repairs_pkey;
+ALTER TABLE repairs ADD PRIMARY KEY (network, name);
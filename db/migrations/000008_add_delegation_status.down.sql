@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_delegations_network_status_timestamp_desc;
+DELETE FROM delegations WHERE status <> 'applied';
+ALTER TABLE delegations
+    DROP COLUMN IF EXISTS errors,
+    DROP COLUMN IF EXISTS status;
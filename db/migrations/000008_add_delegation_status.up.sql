@@ -0,0 +1,7 @@
+-- Rows ingested before every status was fetched are all applied.
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'applied',
+    ADD COLUMN IF NOT EXISTS errors TEXT[];
+
+CREATE INDEX IF NOT EXISTS idx_delegations_network_status_timestamp_desc
+    ON delegations (network, status, timestamp DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS staking_operations;
+DELETE FROM sync_state WHERE name = 'staking';
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS staking_operations (
+    id BIGSERIAL PRIMARY KEY,
+    network TEXT NOT NULL DEFAULT 'mainnet',
+    tzkt_id BIGINT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    level BIGINT NOT NULL,
+    year INT NOT NULL,
+    staker TEXT NOT NULL,
+    baker TEXT,
+    baker_alias TEXT,
+    action TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    CONSTRAINT staking_operations_network_tzkt_id_key UNIQUE (network, tzkt_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_staking_operations_network_timestamp_desc
+    ON staking_operations (network, timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS idx_staking_operations_network_year_timestamp_desc
+    ON staking_operations (network, year, timestamp DESC);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS reconciliations (
+    id BIGSERIAL PRIMARY KEY,
+    network TEXT NOT NULL DEFAULT 'mainnet',
+    run_at TIMESTAMPTZ NOT NULL,
+    from_level BIGINT NOT NULL,
+    to_level BIGINT NOT NULL,
+    stored_count INT NOT NULL,
+    source_count INT NOT NULL,
+    repaired_ids BIGINT[] NOT NULL DEFAULT '{}',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliations_network_run_at
+    ON reconciliations (network, run_at DESC);
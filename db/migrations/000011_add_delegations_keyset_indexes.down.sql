@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_delegations_network_timestamp_desc
+    ON delegations (network, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_year_timestamp_desc
+    ON delegations (network, year, timestamp DESC);
+
+DROP INDEX IF EXISTS idx_delegations_network_timestamp_id_desc;
+DROP INDEX IF EXISTS idx_delegations_network_year_timestamp_id_desc;
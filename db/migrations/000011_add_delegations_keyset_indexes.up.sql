@@ -0,0 +1,9 @@
+-- Keyset pages are ordered by (timestamp, id): the id breaks ties between
+-- delegations of the same block.
+CREATE INDEX IF NOT EXISTS idx_delegations_network_timestamp_id_desc
+    ON delegations (network, timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_year_timestamp_id_desc
+    ON delegations (network, year, timestamp DESC, id DESC);
+
+DROP INDEX IF EXISTS idx_delegations_network_timestamp_desc;
+DROP INDEX IF EXISTS idx_delegations_network_year_timestamp_desc;
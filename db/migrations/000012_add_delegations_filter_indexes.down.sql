@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_delegations_network_delegator_timestamp_id_desc;
+DROP INDEX IF EXISTS idx_delegations_network_baker_timestamp_id_desc;
+DROP INDEX IF EXISTS idx_delegations_network_amount;
@@ -0,0 +1,8 @@
+-- Filters of /xtz/delegations, each ordered like its pages. Level ranges use
+-- idx_delegations_network_level.
+CREATE INDEX IF NOT EXISTS idx_delegations_network_delegator_timestamp_id_desc
+    ON delegations (network, delegator, timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_baker_timestamp_id_desc
+    ON delegations (network, baker, timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_delegations_network_amount
+    ON delegations (network, amount);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_delegations_network_previous_baker_timestamp_id_desc;
@@ -0,0 +1,4 @@
+-- Delegators leaving a baker, for /xtz/bakers/{address}/events. Joins use
+-- idx_delegations_network_baker_timestamp_id_desc.
+CREATE INDEX IF NOT EXISTS idx_delegations_network_previous_baker_timestamp_id_desc
+    ON delegations (network, previous_baker, timestamp DESC, id DESC);
@@ -0,0 +1,20 @@
+-- Levels where a batch of the former timestamp-cursor poller ended, for the
+-- one-time boundary repair. Rows written by one batch share the xmin of its
+-- transaction, but xmin changes whenever a row is rewritten, e.g. by an
+-- UPDATE or a table rewrite, so the boundaries are taken here, before any
+-- later migration runs, and kept by network and level.
+CREATE TABLE IF NOT EXISTS batch_boundaries (
+    network TEXT NOT NULL,
+    level BIGINT NOT NULL,
+    PRIMARY KEY (network, level)
+);
+
+INSERT INTO batch_boundaries (network, level)
+SELECT DISTINCT ON (d.network, d.xmin::text) d.network, d.level
+FROM delegations d
+WHERE NOT EXISTS (
+    SELECT 1 FROM repairs r
+    WHERE r.network = d.network AND r.name = 'timestamp-cursor-boundaries'
+)
+ORDER BY d.network, d.xmin::text, d.tzkt_id DESC
+ON CONFLICT DO NOTHING;
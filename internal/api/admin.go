@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tezos-delegation-service/internal/verify"
+)
+
+// maxVerifySamples bounds the level ranges a single /admin/verify request
+// checks, as each one is fetched from the verification source. Larger checks
+// are run with cmd/verify.
+const maxVerifySamples = 10
+
+// verifyTimeout lets a check end, and its report be written, within the
+// server's 10s write timeout.
+const verifyTimeout = 8 * time.Second
+
+// WithVerifiers serves /admin/verify, which checks stored delegations against
+// a second source with def, or with the verifier of the network given by the
+// network query parameter. def may be nil when the default network has no
+// verification source.
+func WithVerifiers(def *verify.Verifier, networks map[string]*verify.Verifier) Option {
+	return func(s *Server) {
+		s.verifier = def
+		s.verifiers = networks
+	}
+}
+
+// WithAdminToken requires the bearer token to be sent to /admin endpoints,
+// which are not served without one.
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// requireAdmin rejects requests without the admin token. It fails closed:
+// with no token configured, every request is rejected.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	v := s.verifier
+	if network := r.URL.Query().Get("network"); network != "" {
+		var ok bool
+		if v, ok = s.verifiers[network]; !ok {
+			http.Error(w, "unknown network", http.StatusBadRequest)
+			return
+		}
+	}
+	if v == nil {
+		http.Error(w, "no verification source for the network", http.StatusBadRequest)
+		return
+	}
+
+	samples := 0
+	if samplesParam := r.URL.Query().Get("samples"); samplesParam != "" {
+		n, err := strconv.Atoi(samplesParam)
+		if err != nil || n <= 0 || n > maxVerifySamples {
+			http.Error(w, "invalid samples", http.StatusBadRequest)
+			return
+		}
+		samples = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), verifyTimeout)
+	defer cancel()
+	report, err := v.Verify(ctx, samples)
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "verification timed out, check fewer samples or use cmd/verify", http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		log.Printf("verify: %v", err)
+		http.Error(w, "verification failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+	"tezos-delegation-service/internal/verify"
+)
+
+type auditStore struct {
+	rows []store.StoredDelegation
+}
+
+func (s auditStore) LevelBounds(context.Context) (int64, int64, error) {
+	return s.rows[0].Level, s.rows[len(s.rows)-1].Level, nil
+}
+
+func (s auditStore) GetDelegationsInRange(context.Context, int64, int64) ([]store.StoredDelegation, error) {
+	return s.rows, nil
+}
+
+func (s auditStore) CountInRange(context.Context, int64, int64) (int, error) {
+	return len(s.rows), nil
+}
+
+func (s auditStore) SaveReconciliation(context.Context, store.Reconciliation) error {
+	return nil
+}
+
+type verifySource struct {
+	tzkt.Client
+	delegations []tzkt.Delegation
+}
+
+func (s verifySource) FetchDelegationsInRange(context.Context, int64, int64, int64, int) ([]tzkt.Delegation, error) {
+	return s.delegations, nil
+}
+
+func TestRouter_VerifyEndpoint(t *testing.T) {
+	source := tzkt.Delegation{ID: 1, Level: 10, Amount: 150, Status: "applied"}
+	source.Sender.Address = "tz1abc"
+	v := verify.New(verify.Config{
+		Network:    "mainnet",
+		Store:      auditStore{rows: []store.StoredDelegation{{TzktID: 1, Level: 10, Delegator: "tz1abc", Amount: 100, Status: "applied"}}},
+		Source:     verifySource{delegations: []tzkt.Delegation{source}},
+		CompareIDs: true,
+	})
+	router := NewRouter(nil, nil,
+		WithVerifiers(v, map[string]*verify.Verifier{"mainnet": v}),
+		WithAdminToken("secret"),
+	)
+
+	cases := []struct {
+		name   string
+		target string
+		token  string
+		code   int
+	}{
+		{"no token", "/admin/verify", "", http.StatusUnauthorized},
+		{"wrong token", "/admin/verify", "nope", http.StatusUnauthorized},
+		{"unknown network", "/admin/verify?network=ghostnet", "secret", http.StatusBadRequest},
+		{"invalid samples", "/admin/verify?samples=0", "secret", http.StatusBadRequest},
+		{"too many samples", "/admin/verify?samples=11", "secret", http.StatusBadRequest},
+		{"ok", "/admin/verify?network=mainnet&samples=1", "secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tc.code, w.Code, w.Body.String())
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var report verify.Report
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+			require.Equal(t, "mainnet", report.Network)
+			require.Len(t, report.Ranges, 1)
+			require.Equal(t, []verify.Mismatch{{
+				Kind:      verify.KindDifferent,
+				Level:     10,
+				Delegator: "tz1abc",
+				Stored:    &verify.Operation{ID: 1, Amount: 100, Status: "applied"},
+				Source:    &verify.Operation{ID: 1, Amount: 150, Status: "applied"},
+			}}, report.Mismatches)
+		})
+	}
+}
+
+func TestRouter_VerifyEndpoint_DisabledWithoutVerifier(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewRouter(nil, nil, WithAdminToken("secret")).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/verify", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRouter_VerifyEndpoint_DisabledWithoutToken(t *testing.T) {
+	v := verify.New(verify.Config{Store: auditStore{}, Source: verifySource{}})
+	router := NewRouter(nil, nil, WithVerifiers(v, map[string]*verify.Verifier{"mainnet": v}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/verify", nil))
+	require.Equal(t, http.StatusNotFound, w.Code, "no token must not mean no authentication")
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"tezos-delegation-service/internal/store"
+)
+
+type bakerDelegator struct {
+	Delegator string `json:"delegator"`
+	// Amount is the balance delegated, as of the delegation.
+	Amount   string `json:"amount"`
+	JoinedAt string `json:"joined_at"`
+	Level    string `json:"level"`
+}
+
+type bakerDelegatorsResponse struct {
+	Data []bakerDelegator `json:"data"`
+}
+
+// Kinds of baker events.
+const (
+	eventJoin  = "join"
+	eventLeave = "leave"
+)
+
+// bakerEvent is a delegator joining the baker, from PreviousBaker if any, or
+// leaving it, for Baker or none.
+type bakerEvent struct {
+	Type          string         `json:"type"`
+	Timestamp     string         `json:"timestamp"`
+	Delegator     string         `json:"delegator"`
+	Amount        string         `json:"amount"`
+	Level         string         `json:"level"`
+	Baker         *responseBaker `json:"baker"`
+	PreviousBaker *responseBaker `json:"previous_baker"`
+}
+
+type bakerEventsResponse struct {
+	Data []bakerEvent `json:"data"`
+}
+
+// bakerRequest returns the store and the baker address of a baker request,
+// or answers it with an error.
+func (s *Server) bakerRequest(w http.ResponseWriter, r *http.Request) (store.DelegationStore, string, bool) {
+	st, ok := networkStore(w, r, s.store, s.networks)
+	if !ok {
+		return nil, "", false
+	}
+	address := r.PathValue("address")
+	if err := checkAddress("baker", address, accountPrefixes[:4]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+	return st, address, true
+}
+
+func (s *Server) handleBakerDelegators(w http.ResponseWriter, r *http.Request) {
+	st, baker, ok := s.bakerRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Has("year") {
+		http.Error(w, "invalid year: current delegators cannot be filtered by year", http.StatusBadRequest)
+		return
+	}
+	_, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := st.GetBakerDelegators(r.Context(), baker, pageSize, offset)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	out := bakerDelegatorsResponse{Data: make([]bakerDelegator, 0, len(rows))}
+	for _, d := range rows {
+		out.Data = append(out.Data, bakerDelegator{
+			Delegator: d.Delegator,
+			Amount:    strconv.FormatInt(d.Amount, 10),
+			JoinedAt:  formatTimestamp(d.Timestamp),
+			Level:     strconv.FormatInt(d.Level, 10),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleBakerEvents(w http.ResponseWriter, r *http.Request) {
+	st, baker, ok := s.bakerRequest(w, r)
+	if !ok {
+		return
+	}
+	year, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := st.GetBakerEvents(r.Context(), baker, year, pageSize, offset)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	out := bakerEventsResponse{Data: make([]bakerEvent, 0, len(rows))}
+	for _, d := range rows {
+		kind := eventLeave
+		if d.Baker == baker {
+			kind = eventJoin
+		}
+		out.Data = append(out.Data, bakerEvent{
+			Type:          kind,
+			Timestamp:     formatTimestamp(d.Timestamp),
+			Delegator:     d.Delegator,
+			Amount:        strconv.FormatInt(d.Amount, 10),
+			Level:         strconv.FormatInt(d.Level, 10),
+			Baker:         newResponseBaker(d.Baker, d.BakerAlias),
+			PreviousBaker: newResponseBaker(d.PreviousBaker, d.PreviousBakerAlias),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+)
+
+// bakerStore serves the delegations of a single baker and records the pages
+// requested.
+type bakerStore struct {
+	store.DelegationStore
+	delegators, events []store.Delegation
+	year               *int
+	offset             int
+}
+
+func (s *bakerStore) GetBakerDelegators(_ context.Context, baker string, _, offset int) ([]store.Delegation, error) {
+	s.offset = offset
+	if baker != testBaker {
+		return nil, nil
+	}
+	return s.delegators, nil
+}
+
+func (s *bakerStore) GetBakerEvents(_ context.Context, baker string, year *int, _, offset int) ([]store.Delegation, error) {
+	s.year, s.offset = year, offset
+	if baker != testBaker {
+		return nil, nil
+	}
+	return s.events, nil
+}
+
+func TestRouter_BakerDelegatorsEndpoint(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := &bakerStore{delegators: []store.Delegation{
+		{Timestamp: ts, Amount: 1500, Delegator: testDelegator, Level: 10, Baker: testBaker},
+	}}
+	router := NewRouter(st, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/xtz/bakers/"+testBaker+"/delegators?page=3", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, 2*pageSize, st.offset)
+
+	var resp bakerDelegatorsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, []bakerDelegator{{Delegator: testDelegator, Amount: "1500", JoinedAt: "2024-01-01T00:00:00Z", Level: "10"}}, resp.Data)
+
+	for target, msg := range map[string]string{
+		"/xtz/bakers/KT1JejNYjmQYh8yw95u5kfQDRuxJcaUPjUnf/delegators": "invalid baker",
+		"/xtz/bakers/" + testBaker + "/delegators?page=0":             "invalid page",
+		"/xtz/bakers/" + testBaker + "/delegators?year=2024":          "invalid year",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, target)
+		require.Contains(t, w.Body.String(), msg)
+	}
+}
+
+func TestRouter_BakerEventsEndpoint(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := &bakerStore{events: []store.Delegation{
+		{Timestamp: ts.Add(time.Hour), Amount: 10, Delegator: "tz1leaving", Level: 11, PreviousBaker: testBaker},
+		{Timestamp: ts, Amount: 20, Delegator: "tz1joining", Level: 10, Baker: testBaker, PreviousBaker: "tz1before", PreviousBakerAlias: "Before"},
+	}}
+	router := NewRouter(st, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/xtz/bakers/"+testBaker+"/events?year=2024", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, 2024, *st.year)
+
+	var resp bakerEventsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, []bakerEvent{
+		{Type: eventLeave, Timestamp: "2024-01-01T01:00:00Z", Delegator: "tz1leaving", Amount: "10", Level: "11",
+			PreviousBaker: &responseBaker{Address: testBaker}},
+		{Type: eventJoin, Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1joining", Amount: "20", Level: "10",
+			Baker: &responseBaker{Address: testBaker}, PreviousBaker: &responseBaker{Address: "tz1before", Alias: "Before"}},
+	}, resp.Data)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/xtz/bakers/"+testBaker+"/events?year=1999", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor returns the opaque cursor of the page following d.
+func encodeCursor(d store.Delegation) string {
+	raw := fmt.Sprintf("%d.%d", d.Timestamp.UnixNano(), d.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor returned by encodeCursor.
+func decodeCursor(cursor string) (*store.PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	rowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || rowID <= 0 {
+		return nil, errInvalidCursor
+	}
+	return &store.PageCursor{Timestamp: time.Unix(0, nanos).UTC(), ID: rowID}, nil
+}
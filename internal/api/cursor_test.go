@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 12, 30, 0, 123456789, time.UTC)
+	cursor := encodeCursor(store.Delegation{ID: 42, Timestamp: ts})
+
+	after, err := decodeCursor(cursor)
+	require.NoError(t, err)
+	require.Equal(t, &store.PageCursor{Timestamp: ts, ID: 42}, after)
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"%%%", "bm9wZQ", "MTIzLmFiYw", "MTIzLjA"} {
+		_, err := decodeCursor(cursor)
+		require.ErrorIs(t, err, errInvalidCursor, cursor)
+	}
+}
+
+func TestRouter_DelegationsEndpoint_InvalidCursor(t *testing.T) {
+	router := NewRouter(nil, nil)
+	valid := encodeCursor(store.Delegation{ID: 1, Timestamp: time.Now()})
+
+	cases := map[string]string{
+		"/xtz/delegations?cursor=nope":                 "invalid cursor",
+		"/xtz/delegations?cursor=" + valid + "&page=2": "cursor and page cannot be combined",
+	}
+	for target, msg := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, target)
+		require.Contains(t, w.Body.String(), msg)
+	}
+}
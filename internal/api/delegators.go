@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+)
+
+type delegatorResponse struct {
+	Address      string         `json:"address"`
+	CurrentBaker *responseBaker `json:"current_baker"`
+	FirstSeen    string         `json:"first_seen"`
+	LastChange   string         `json:"last_change"`
+	// Delegations are the delegation periods of the address, oldest first.
+	Delegations []delegationPeriod `json:"delegations"`
+}
+
+// delegationPeriod is a delegation and how long it lasted: until the next
+// delegation of the address, or until now for the current one, which has no
+// EndedAt.
+type delegationPeriod struct {
+	Timestamp       string         `json:"timestamp"`
+	Amount          string         `json:"amount"`
+	Level           string         `json:"level"`
+	Baker           *responseBaker `json:"baker"`
+	PreviousBaker   *responseBaker `json:"previous_baker"`
+	EndedAt         *string        `json:"ended_at"`
+	DurationSeconds int64          `json:"duration_seconds"`
+}
+
+func (s *Server) handleDelegator(w http.ResponseWriter, r *http.Request) {
+	st, ok := networkStore(w, r, s.store, s.networks)
+	if !ok {
+		return
+	}
+
+	address := r.PathValue("address")
+	if err := checkAddress("address", address, accountPrefixes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := st.GetDelegatorHistory(r.Context(), address)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(w, "no delegation from this address", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(delegatorHistory(address, rows, time.Now()))
+}
+
+// delegatorHistory summarizes the delegations of address, oldest first, as
+// of now.
+func delegatorHistory(address string, rows []store.Delegation, now time.Time) delegatorResponse {
+	first, last := rows[0], rows[len(rows)-1]
+	out := delegatorResponse{
+		Address:      address,
+		CurrentBaker: newResponseBaker(last.Baker, last.BakerAlias),
+		FirstSeen:    formatTimestamp(first.Timestamp),
+		LastChange:   formatTimestamp(last.Timestamp),
+		Delegations:  make([]delegationPeriod, 0, len(rows)),
+	}
+	for i, d := range rows {
+		end := now
+		p := delegationPeriod{
+			Timestamp:     formatTimestamp(d.Timestamp),
+			Amount:        strconv.FormatInt(d.Amount, 10),
+			Level:         strconv.FormatInt(d.Level, 10),
+			Baker:         newResponseBaker(d.Baker, d.BakerAlias),
+			PreviousBaker: newResponseBaker(d.PreviousBaker, d.PreviousBakerAlias),
+		}
+		if i+1 < len(rows) {
+			end = rows[i+1].Timestamp
+			endedAt := formatTimestamp(end)
+			p.EndedAt = &endedAt
+		}
+		p.DurationSeconds = int64(max(end.Sub(d.Timestamp), 0) / time.Second)
+		out.Delegations = append(out.Delegations, p)
+	}
+	return out
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
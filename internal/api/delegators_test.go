@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+)
+
+// historyStore serves the history of a single delegator.
+type historyStore struct {
+	store.DelegationStore
+	delegator string
+	rows      []store.Delegation
+}
+
+func (s historyStore) GetDelegatorHistory(_ context.Context, delegator string) ([]store.Delegation, error) {
+	if delegator != s.delegator {
+		return nil, nil
+	}
+	return s.rows, nil
+}
+
+func TestDelegatorHistory_Periods(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []store.Delegation{
+		{Timestamp: ts, Amount: 100, Level: 10, Baker: "tz1first"},
+		{Timestamp: ts.Add(24 * time.Hour), Amount: 200, Level: 20, PreviousBaker: "tz1first"},
+		{Timestamp: ts.Add(36 * time.Hour), Amount: 300, Level: 30, Baker: "tz1second", BakerAlias: "Second"},
+	}
+
+	got := delegatorHistory(testDelegator, rows, ts.Add(40*time.Hour))
+	require.Equal(t, testDelegator, got.Address)
+	require.Equal(t, &responseBaker{Address: "tz1second", Alias: "Second"}, got.CurrentBaker)
+	require.Equal(t, "2024-01-01T00:00:00Z", got.FirstSeen)
+	require.Equal(t, "2024-01-02T12:00:00Z", got.LastChange)
+
+	require.Len(t, got.Delegations, 3)
+	require.Equal(t, "2024-01-02T00:00:00Z", *got.Delegations[0].EndedAt)
+	require.Equal(t, int64(24*3600), got.Delegations[0].DurationSeconds)
+	require.Nil(t, got.Delegations[1].Baker, "an undelegation")
+	require.Equal(t, int64(12*3600), got.Delegations[1].DurationSeconds)
+	require.Nil(t, got.Delegations[2].EndedAt, "the current delegation")
+	require.Equal(t, int64(4*3600), got.Delegations[2].DurationSeconds)
+
+	got = delegatorHistory(testDelegator, rows[1:2], ts)
+	require.Nil(t, got.CurrentBaker, "undelegated")
+}
+
+func TestRouter_DelegatorEndpoint(t *testing.T) {
+	st := historyStore{delegator: testDelegator, rows: []store.Delegation{
+		{Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 100, Level: 10, Baker: testBaker},
+	}}
+	router := NewRouter(st, nil)
+
+	cases := []struct {
+		target string
+		code   int
+	}{
+		{"/xtz/delegators/" + testDelegator, http.StatusOK},
+		{"/xtz/delegators/" + testBaker, http.StatusNotFound},
+		{"/xtz/delegators/tz1short", http.StatusBadRequest},
+		{"/xtz/delegators/" + testDelegator + "?network=ghostnet", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		require.Equal(t, tc.code, w.Code, tc.target)
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var resp delegatorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		require.Equal(t, testDelegator, resp.Address)
+		require.Equal(t, testBaker, resp.CurrentBaker.Address)
+		require.Len(t, resp.Delegations, 1)
+		require.Nil(t, resp.Delegations[0].EndedAt)
+		require.Positive(t, resp.Delegations[0].DurationSeconds)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+)
+
+// accountPrefixes are the prefixes of Tezos addresses, implicit accounts
+// first. Only implicit accounts bake.
+var accountPrefixes = []string{"tz1", "tz2", "tz3", "tz4", "KT1"}
+
+// delegationFilter parses the filters of a delegations request. Each error
+// names the parameter at fault.
+func delegationFilter(q url.Values, year *int) (store.DelegationFilter, error) {
+	filter := store.DelegationFilter{Year: year}
+
+	// Only applied delegations changed a delegate; the others are listed on request.
+	filter.Statuses = []string{"applied"}
+	if statusParam := q.Get("status"); statusParam != "" {
+		filter.Statuses = strings.Split(statusParam, ",")
+		for _, status := range filter.Statuses {
+			if !delegationStatuses[status] {
+				return filter, fmt.Errorf("invalid status %q: expected applied, failed, backtracked or skipped", status)
+			}
+		}
+	}
+
+	var err error
+	if filter.Delegator, err = addressParam(q, "delegator", accountPrefixes); err != nil {
+		return filter, err
+	}
+	if filter.Baker, err = addressParam(q, "baker", accountPrefixes[:4]); err != nil {
+		return filter, err
+	}
+	if filter.MinLevel, filter.MaxLevel, err = rangeParams(q, "min_level", "max_level"); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, filter.MaxAmount, err = rangeParams(q, "min_amount", "max_amount"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = timeParam(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = timeParam(q, "to"); err != nil {
+		return filter, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("invalid time range: from must be before to")
+	}
+	return filter, nil
+}
+
+// addressParam returns the address in q[name], checked by checkAddress.
+func addressParam(q url.Values, name string, prefixes []string) (string, error) {
+	v := q.Get(name)
+	if v == "" {
+		return "", nil
+	}
+	if err := checkAddress(name, v, prefixes); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// base58Alphabet is the alphabet of base58check, the encoding of addresses.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// checkAddress rejects an address that does not start with one of prefixes
+// or is not base58. It does not verify the checksum: an unknown address
+// matches nothing.
+func checkAddress(name, address string, prefixes []string) error {
+	if len(address) != 36 || !hasAnyPrefix(address, prefixes) || strings.Trim(address, base58Alphabet) != "" {
+		return fmt.Errorf("invalid %s: expected a %s address", name, strings.Join(prefixes, ", "))
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeParams returns the non-negative bounds in q[minName] and q[maxName],
+// nil when absent.
+func rangeParams(q url.Values, minName, maxName string) (*int64, *int64, error) {
+	parse := func(name string) (*int64, error) {
+		v := q.Get(name)
+		if v == "" {
+			return nil, nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: expected a non-negative integer", name)
+		}
+		return &n, nil
+	}
+	lo, err := parse(minName)
+	if err != nil {
+		return nil, nil, err
+	}
+	hi, err := parse(maxName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lo != nil && hi != nil && *lo > *hi {
+		return nil, nil, fmt.Errorf("invalid range: %s is greater than %s", minName, maxName)
+	}
+	return lo, hi, nil
+}
+
+// timeParam returns the RFC 3339 timestamp in q[name], zero when absent.
+func timeParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected an RFC 3339 timestamp such as 2024-01-01T00:00:00Z", name)
+	}
+	return t, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+)
+
+const (
+	testDelegator = "tz1a1SAaXRt9yoGMx29rh9FsBF4UzmvojdTL"
+	testBaker     = "tz1irJKkXS2DBWkU1NnmFQx1c1L7pbGg4yhk"
+)
+
+func TestDelegationFilter_Parses(t *testing.T) {
+	q := url.Values{
+		"status":     {"applied,failed"},
+		"delegator":  {testDelegator},
+		"baker":      {testBaker},
+		"min_level":  {"100"},
+		"max_level":  {"100"},
+		"min_amount": {"0"},
+		"max_amount": {"5000000"},
+		"from":       {"2024-01-01T00:00:00Z"},
+		"to":         {"2024-02-01T00:00:00+01:00"},
+	}
+	year := 2024
+	filter, err := delegationFilter(q, &year)
+	require.NoError(t, err)
+
+	level, minAmount, maxAmount := int64(100), int64(0), int64(5000000)
+	require.Equal(t, store.DelegationFilter{
+		Year:      &year,
+		Statuses:  []string{"applied", "failed"},
+		Delegator: testDelegator,
+		Baker:     testBaker,
+		MinLevel:  &level,
+		MaxLevel:  &level,
+		MinAmount: &minAmount,
+		MaxAmount: &maxAmount,
+		From:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, 2, 1, 0, 0, 0, 0, time.FixedZone("", 3600)),
+	}, filter)
+
+	filter, err = delegationFilter(url.Values{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, store.DelegationFilter{Statuses: []string{"applied"}}, filter, "applied delegations by default")
+}
+
+func TestRouter_DelegationsEndpoint_InvalidFilters(t *testing.T) {
+	router := NewRouter(nil, nil)
+
+	cases := map[string]string{
+		"status=applied,unknown":                            `invalid status "unknown"`,
+		"delegator=tz1short":                                "invalid delegator: expected a tz1, tz2, tz3, tz4, KT1 address",
+		"delegator=tz9a1SAaXRt9yoGMx29rh9FsBF4UzmvojdTL":    "invalid delegator",
+		"delegator=tz1a1SAaXRt9yoGMx29rh9FsBF4Uzmvoj0Il":    "invalid delegator",
+		"baker=KT1JejNYjmQYh8yw95u5kfQDRuxJcaUPjUnf":        "invalid baker: expected a tz1, tz2, tz3, tz4 address",
+		"min_level=-1":                                      "invalid min_level: expected a non-negative integer",
+		"max_level=ten":                                     "invalid max_level",
+		"min_level=10&max_level=9":                          "invalid range: min_level is greater than max_level",
+		"min_amount=1.5":                                    "invalid min_amount",
+		"min_amount=10&max_amount=1":                        "invalid range: min_amount is greater than max_amount",
+		"from=2024-01-01":                                   "invalid from: expected an RFC 3339 timestamp",
+		"to=yesterday":                                      "invalid to",
+		"from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z": "invalid time range: from must be before to",
+	}
+	for query, msg := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/xtz/delegations?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+		require.Contains(t, w.Body.String(), msg, query)
+	}
+}
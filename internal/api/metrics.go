@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Gauge is a value exported on /metrics in the Prometheus text format. Value
+// is read on every scrape.
+type Gauge struct {
+	Name   string
+	Help   string
+	Labels map[string]string
+	Value  func() float64
+}
+
+// WithGauge exports g on /metrics. Gauges sharing a name must differ by labels.
+func WithGauge(g Gauge) Option {
+	return func(s *Server) {
+		s.gauges = append(s.gauges, g)
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	gauges := make([]Gauge, len(s.gauges))
+	copy(gauges, s.gauges)
+	sort.SliceStable(gauges, func(i, j int) bool { return gauges[i].Name < gauges[j].Name })
+
+	var b strings.Builder
+	for i, g := range gauges {
+		if i == 0 || gauges[i-1].Name != g.Name {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.Name, g.Help, g.Name)
+		}
+		b.WriteString(g.Name)
+		b.WriteString(formatLabels(g.Labels))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(g.Value(), 'g', -1, 64))
+		b.WriteByte('\n')
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// formatLabels renders labels sorted by name, e.g. {network="mainnet"}.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.Quote(labels[name]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
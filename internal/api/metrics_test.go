@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_MetricsEndpoint(t *testing.T) {
+	rate := 7.5
+	router := NewRouter(nil, nil,
+		WithGauge(Gauge{
+			Name:   "tzkt_rate_limit_rps",
+			Help:   "Current TzKT request rate limit.",
+			Labels: map[string]string{"network": "mainnet"},
+			Value:  func() float64 { return rate },
+		}),
+		WithGauge(Gauge{
+			Name:   "tzkt_rate_limit_rps",
+			Help:   "Current TzKT request rate limit.",
+			Labels: map[string]string{"network": "ghostnet"},
+			Value:  func() float64 { return 10 },
+		}),
+	)
+
+	rate = 2.5
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Equal(t, `# HELP tzkt_rate_limit_rps Current TzKT request rate limit.
+# TYPE tzkt_rate_limit_rps gauge
+tzkt_rate_limit_rps{network="mainnet"} 2.5
+tzkt_rate_limit_rps{network="ghostnet"} 10
+`, w.Body.String())
+}
+
+func TestStatusRouter_ServesOnlyStatus(t *testing.T) {
+	router := NewStatusRouter(nil, WithGauge(Gauge{
+		Name:  "tzkt_rate_limit_rps",
+		Help:  "Current TzKT request rate limit.",
+		Value: func() float64 { return 10 },
+	}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "tzkt_rate_limit_rps 10\n")
+
+	for _, path := range []string{"/xtz/delegations", "/xtz/staking", "/admin/verify"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
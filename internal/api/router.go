@@ -4,25 +4,91 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/verify"
 )
 
 type Server struct {
 	store store.DelegationStore
 	db    *sql.DB
+	// networks are the stores selectable with the network query parameter.
+	networks map[string]store.DelegationStore
+	checks   map[string]HealthCheck
+	gauges   []Gauge
+	// staking serves /xtz/staking when set, with stakingNetworks selectable
+	// like networks.
+	staking         store.StakingStore
+	stakingNetworks map[string]store.StakingStore
+	// verifiers serve /admin/verify, verifier being the default one, if any.
+	verifier   *verify.Verifier
+	verifiers  map[string]*verify.Verifier
+	adminToken string
 }
 
-func NewRouter(s store.DelegationStore, db *sql.DB) http.Handler {
-	srv := &Server{store: s, db: db}
+// HealthCheck reports the state of a dependency for /health. A check that
+// fails marks the service degraded rather than unhealthy: stored data can
+// still be served while, e.g., the upstream API is unavailable.
+type HealthCheck func(ctx context.Context) (string, error)
+
+// Option configures optional features of the router.
+type Option func(*Server)
+
+// WithNetworks serves each network's delegations from its own store, picked
+// with the network query parameter. Requests without the parameter are
+// still served from the store passed to NewRouter.
+func WithNetworks(stores map[string]store.DelegationStore) Option {
+	return func(s *Server) {
+		s.networks = stores
+	}
+}
+
+// WithStaking serves staking operations at /xtz/staking from def, or from the
+// store of the network given by the network query parameter.
+func WithStaking(def store.StakingStore, networks map[string]store.StakingStore) Option {
+	return func(s *Server) {
+		s.staking = def
+		s.stakingNetworks = networks
+	}
+}
+
+// WithHealthCheck adds a named check to the /health report.
+func WithHealthCheck(name string, check HealthCheck) Option {
+	return func(s *Server) {
+		s.checks[name] = check
+	}
+}
+
+func NewRouter(s store.DelegationStore, db *sql.DB, opts ...Option) http.Handler {
+	srv := &Server{
+		store:    s,
+		db:       db,
+		networks: map[string]store.DelegationStore{store.DefaultNetwork: s},
+		checks:   make(map[string]HealthCheck),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", srv.handleHealth)
+	mux.HandleFunc("/metrics", srv.handleMetrics)
 	mux.HandleFunc("/xtz/delegations", srv.handleDelegations)
+	mux.HandleFunc("/xtz/delegators/{address}", srv.handleDelegator)
+	mux.HandleFunc("/xtz/bakers/{address}/delegators", srv.handleBakerDelegators)
+	mux.HandleFunc("/xtz/bakers/{address}/events", srv.handleBakerEvents)
+	if srv.staking != nil {
+		mux.HandleFunc("/xtz/staking", srv.handleStaking)
+	}
+	if srv.adminToken != "" && (srv.verifier != nil || len(srv.verifiers) > 0) {
+		mux.HandleFunc("/admin/verify", srv.requireAdmin(srv.handleVerify))
+	}
 
 	handler := loggingMiddleware(mux)
 	handler = recoveryMiddleware(handler)
@@ -31,15 +97,78 @@ func NewRouter(s store.DelegationStore, db *sql.DB) http.Handler {
 	return handler
 }
 
+// NewStatusRouter serves only /health and /metrics, for a process that
+// ingests without serving the API.
+func NewStatusRouter(db *sql.DB, opts ...Option) http.Handler {
+	srv := &Server{
+		db:     db,
+		checks: make(map[string]HealthCheck),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", srv.handleHealth)
+	mux.HandleFunc("/metrics", srv.handleMetrics)
+
+	handler := loggingMiddleware(mux)
+	handler = recoveryMiddleware(handler)
+
+	return handler
+}
+
+type responseBaker struct {
+	Address string `json:"address"`
+	Alias   string `json:"alias,omitempty"`
+}
+
 type responseDelegation struct {
-	Timestamp string `json:"timestamp"`
-	Amount    string `json:"amount"`
-	Delegator string `json:"delegator"`
-	Level     string `json:"level"`
+	Timestamp     string         `json:"timestamp"`
+	Amount        string         `json:"amount"`
+	Delegator     string         `json:"delegator"`
+	Level         string         `json:"level"`
+	Baker         *responseBaker `json:"baker"`
+	PreviousBaker *responseBaker `json:"previous_baker"`
+	Status        string         `json:"status"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+// delegationStatuses are the statuses a delegation can be stored with.
+var delegationStatuses = map[string]bool{
+	"applied":     true,
+	"failed":      true,
+	"backtracked": true,
+	"skipped":     true,
+}
+
+// newResponseBaker returns nil when the address is unknown so that the
+// field is rendered as null (e.g. the baker of an undelegation).
+func newResponseBaker(address, alias string) *responseBaker {
+	if address == "" {
+		return nil
+	}
+	return &responseBaker{Address: address, Alias: alias}
 }
 
 type response struct {
 	Data []responseDelegation `json:"data"`
+	// NextCursor, passed as the cursor parameter, requests the next page. It
+	// is omitted when the page is not full.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type responseStakingOperation struct {
+	Timestamp string         `json:"timestamp"`
+	Amount    string         `json:"amount"`
+	Staker    string         `json:"staker"`
+	Level     string         `json:"level"`
+	Action    string         `json:"action"`
+	Baker     *responseBaker `json:"baker"`
+}
+
+type stakingResponse struct {
+	Data []responseStakingOperation `json:"data"`
 }
 
 type healthResponse struct {
@@ -50,35 +179,60 @@ type healthResponse struct {
 
 var startTime = time.Now()
 
+// networkStore returns the store of the network query parameter, or def. It
+// answers an unknown network itself.
+func networkStore[S any](w http.ResponseWriter, r *http.Request, def S, networks map[string]S) (S, bool) {
+	network := r.URL.Query().Get("network")
+	if network == "" {
+		return def, true
+	}
+	st, ok := networks[network]
+	if !ok {
+		http.Error(w, "unknown network", http.StatusBadRequest)
+	}
+	return st, ok
+}
+
 func (s *Server) handleDelegations(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	yearParam := r.URL.Query().Get("year")
-	var year *int
-	if yearParam != "" {
-		y, err := strconv.Atoi(yearParam)
-		if err != nil || y < 2018 {
-			http.Error(w, "invalid year", http.StatusBadRequest)
-			return
-		}
-		year = &y
+	st, ok := networkStore(w, r, s.store, s.networks)
+	if !ok {
+		return
 	}
 
-	pageParam := r.URL.Query().Get("page")
-	page := 1
-	if pageParam != "" {
-		p, err := strconv.Atoi(pageParam)
-		if err != nil || p <= 0 {
-			http.Error(w, "invalid page", http.StatusBadRequest)
+	year, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A cursor pages from the last delegation seen rather than by offset, so
+	// deep pages stay fast and do not shift as new delegations arrive.
+	var after *store.PageCursor
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		if r.URL.Query().Get("page") != "" {
+			http.Error(w, "cursor and page cannot be combined", http.StatusBadRequest)
+			return
+		}
+		if after, err = decodeCursor(cursorParam); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		page = p
 	}
 
-	const pageSize = 50
-	offset := (page - 1) * pageSize
+	filter, err := delegationFilter(r.URL.Query(), year)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	rows, err := s.store.GetPage(ctx, year, pageSize, offset)
+	var rows []store.Delegation
+	if after != nil {
+		rows, err = st.GetPageAfter(ctx, filter, after, pageSize)
+	} else {
+		rows, err = st.GetPage(ctx, filter, pageSize, offset)
+	}
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -89,17 +243,88 @@ func (s *Server) handleDelegations(w http.ResponseWriter, r *http.Request) {
 	}
 	for _, d := range rows {
 		out.Data = append(out.Data, responseDelegation{
-			Timestamp: d.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
-			Amount:    strconv.FormatInt(d.Amount, 10),
-			Delegator: d.Delegator,
-			Level:     strconv.FormatInt(d.Level, 10),
+			Timestamp:     formatTimestamp(d.Timestamp),
+			Amount:        strconv.FormatInt(d.Amount, 10),
+			Delegator:     d.Delegator,
+			Level:         strconv.FormatInt(d.Level, 10),
+			Baker:         newResponseBaker(d.Baker, d.BakerAlias),
+			PreviousBaker: newResponseBaker(d.PreviousBaker, d.PreviousBakerAlias),
+			Status:        d.Status,
+			Errors:        d.Errors,
 		})
 	}
+	if len(rows) == pageSize {
+		out.NextCursor = encodeCursor(rows[len(rows)-1])
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(out)
 }
 
+func (s *Server) handleStaking(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	st, ok := networkStore(w, r, s.staking, s.stakingNetworks)
+	if !ok {
+		return
+	}
+
+	year, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := st.GetStakingPage(ctx, year, pageSize, offset)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	out := stakingResponse{
+		Data: make([]responseStakingOperation, 0, len(rows)),
+	}
+	for _, op := range rows {
+		out.Data = append(out.Data, responseStakingOperation{
+			Timestamp: op.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			Amount:    strconv.FormatInt(op.Amount, 10),
+			Staker:    op.Staker,
+			Level:     strconv.FormatInt(op.Level, 10),
+			Action:    op.Action,
+			Baker:     newResponseBaker(op.Baker, op.BakerAlias),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// pageSize is the number of items per page of the listing endpoints.
+const pageSize = 50
+
+// pageParams parses the year filter and the page of a listing request into
+// the offset of its first item.
+func pageParams(q url.Values) (*int, int, error) {
+	var year *int
+	if yearParam := q.Get("year"); yearParam != "" {
+		y, err := strconv.Atoi(yearParam)
+		if err != nil || y < 2018 {
+			return nil, 0, errors.New("invalid year")
+		}
+		year = &y
+	}
+
+	page := 1
+	if pageParam := q.Get("page"); pageParam != "" {
+		p, err := strconv.Atoi(pageParam)
+		if err != nil || p <= 0 {
+			return nil, 0, errors.New("invalid page")
+		}
+		page = p
+	}
+	return year, (page - 1) * pageSize, nil
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
@@ -121,6 +346,18 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		checks["database_connections"] = strconv.Itoa(stats.OpenConnections) + " open"
 	}
 
+	for name, check := range s.checks {
+		detail, err := check(ctx)
+		if err != nil {
+			checks[name] = "degraded: " + err.Error()
+			if status == "healthy" {
+				status = "degraded"
+			}
+			continue
+		}
+		checks[name] = detail
+	}
+
 	resp := healthResponse{
 		Status: status,
 		Checks: checks,
@@ -128,7 +365,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if status != "healthy" {
+	if status == "unhealthy" {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	} else {
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,165 @@
+package faketzkt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"time"
+
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// Delegation is a delegation operation as served by the fake, with the
+// fields of the TzKT API that the service reads or filters on.
+type Delegation struct {
+	Type string `json:"type"`
+	tzkt.Delegation
+}
+
+// Dataset is the chain served by a fake TzKT server.
+type Dataset struct {
+	// Delegations are ordered by id.
+	Delegations []Delegation
+	// Blocks are ordered by level; the last one is the head.
+	Blocks []tzkt.Block
+	// Staking holds applied staking operations, ordered by id.
+	Staking []tzkt.StakingOperation
+}
+
+// blockTime is the block interval of synthetic chains.
+const blockTime = 30 * time.Second
+
+// Synthetic generates n delegations spread over a chain starting at start,
+// deterministically for a given seed. About one delegation in twenty fails,
+// and a few are undelegations. About one applied delegation to a baker in five
+// is followed by a stake, and some stakes by an unstake.
+func Synthetic(n int, start time.Time, seed uint64) Dataset {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	bakers := []tzkt.Account{
+		{Address: "tz1irJKkXS2DBWkU1NnmFQx1c1L7pbGg4yhk", Alias: "Coinbase Baker"},
+		{Address: "tz1Kf25fX1VdmYGSEzwFy1wNmkbSEZ2V83sY", Alias: "Tezos Seoul"},
+		{Address: "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM", Alias: "Everstake"},
+		{Address: "tz1NortRftucvAkD1J58L32EhSVrQEWJCEnB"},
+	}
+	current := make(map[int]*tzkt.Account)
+
+	var ds Dataset
+	level := int64(1)
+	id := int64(1000)
+	for i := 0; i < n; i++ {
+		// Several delegations may share a block, as they do on chain.
+		if rng.IntN(3) == 0 || i == 0 {
+			level += 1 + rng.Int64N(5)
+		}
+		id += 1 + rng.Int64N(1000)
+		ts := start.Add(time.Duration(level) * blockTime).UTC()
+
+		sender := rng.IntN(n/4 + 1)
+		d := Delegation{Type: "delegation"}
+		d.ID = id
+		d.Status = "applied"
+		d.Level = level
+		d.Block = blockHash(level)
+		d.Timestamp = ts
+		d.Amount = 1_000_000 + rng.Int64N(10_000_000_000)
+		d.Sender.Address = fmt.Sprintf("tz1Fake%029d", sender)
+		d.PrevDelegate = current[sender]
+		if rng.IntN(10) != 0 || d.PrevDelegate == nil {
+			baker := bakers[rng.IntN(len(bakers))]
+			d.NewDelegate = &baker
+		}
+		if rng.IntN(20) == 0 {
+			d.Status = "failed"
+			d.Errors = []tzkt.OperationError{{Type: "contract.manager.unregistered_delegate"}}
+		} else {
+			current[sender] = d.NewDelegate
+		}
+		ds.Delegations = append(ds.Delegations, d)
+	}
+
+	// Staking draws from its own generator so that the delegations of a seed
+	// stay the same whether or not staking is generated.
+	srng := rand.New(rand.NewPCG(seed, seed+1))
+	for _, d := range ds.Delegations {
+		if d.Status != "applied" || d.NewDelegate == nil || srng.IntN(5) != 0 {
+			continue
+		}
+		// Ids are derived from the delegation's so that they stay unique and
+		// ordered with two staking operations per delegation.
+		op := tzkt.StakingOperation{
+			ID:        2 * d.ID,
+			Level:     d.Level,
+			Block:     d.Block,
+			Timestamp: d.Timestamp,
+			Baker:     d.NewDelegate,
+			Action:    tzkt.StakingStake,
+			Amount:    d.Amount / 2,
+		}
+		op.Sender.Address = d.Sender.Address
+		ds.Staking = append(ds.Staking, op)
+		if srng.IntN(3) == 0 {
+			unstake := op
+			unstake.ID++
+			unstake.Action = tzkt.StakingUnstake
+			unstake.Amount = op.Amount / 2
+			ds.Staking = append(ds.Staking, unstake)
+		}
+	}
+
+	for lvl := int64(1); lvl <= level; lvl++ {
+		ds.Blocks = append(ds.Blocks, tzkt.Block{
+			Level:     lvl,
+			Hash:      blockHash(lvl),
+			Timestamp: start.Add(time.Duration(lvl) * blockTime).UTC(),
+		})
+	}
+	return ds
+}
+
+// LoadDataset reads a JSON array of TzKT delegations, e.g. saved from
+// /v1/operations/delegations. Delegations without a status are applied, and
+// blocks are derived from the levels the delegations were included at.
+func LoadDataset(path string) (Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("read dataset: %w", err)
+	}
+	var delegations []Delegation
+	if err := json.Unmarshal(data, &delegations); err != nil {
+		return Dataset{}, fmt.Errorf("decode dataset %s: %w", path, err)
+	}
+	return NewDataset(delegations), nil
+}
+
+// NewDataset orders delegations by id and derives the blocks they belong to.
+func NewDataset(delegations []Delegation) Dataset {
+	ds := Dataset{Delegations: append([]Delegation(nil), delegations...)}
+	sort.Slice(ds.Delegations, func(i, j int) bool { return ds.Delegations[i].ID < ds.Delegations[j].ID })
+
+	seen := make(map[int64]bool)
+	for i := range ds.Delegations {
+		d := &ds.Delegations[i]
+		if d.Type == "" {
+			d.Type = "delegation"
+		}
+		if d.Status == "" {
+			d.Status = "applied"
+		}
+		if d.Block == "" {
+			d.Block = blockHash(d.Level)
+		}
+		if !seen[d.Level] {
+			seen[d.Level] = true
+			ds.Blocks = append(ds.Blocks, tzkt.Block{Level: d.Level, Hash: d.Block, Timestamp: d.Timestamp})
+		}
+	}
+	sort.Slice(ds.Blocks, func(i, j int) bool { return ds.Blocks[i].Level < ds.Blocks[j].Level })
+	return ds
+}
+
+// blockHash returns a stable, recognisable hash for a synthetic block.
+func blockHash(level int64) string {
+	return fmt.Sprintf("BLfake%045d", level)
+}
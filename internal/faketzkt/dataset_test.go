@@ -0,0 +1,45 @@
+package faketzkt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynthetic_IsDeterministic(t *testing.T) {
+	a := Synthetic(100, genesis, 7)
+	b := Synthetic(100, genesis, 7)
+	require.Equal(t, a, b)
+	require.Len(t, a.Delegations, 100)
+
+	for i := 1; i < len(a.Delegations); i++ {
+		require.Greater(t, a.Delegations[i].ID, a.Delegations[i-1].ID)
+		require.GreaterOrEqual(t, a.Delegations[i].Level, a.Delegations[i-1].Level)
+	}
+	require.Equal(t, a.Delegations[99].Level, a.Blocks[len(a.Blocks)-1].Level)
+}
+
+func TestLoadDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"id": 20, "level": 11, "block": "BLb", "timestamp": "2020-01-01T00:01:00Z", "amount": 2,
+		 "sender": {"address": "tz1b"}, "status": "failed"},
+		{"id": 10, "level": 10, "timestamp": "2020-01-01T00:00:00Z", "amount": 1,
+		 "sender": {"address": "tz1a"}, "newDelegate": {"address": "tz1baker"}}
+	]`), 0o644))
+
+	ds, err := LoadDataset(path)
+	require.NoError(t, err)
+	require.Len(t, ds.Delegations, 2)
+	require.Equal(t, int64(10), ds.Delegations[0].ID)
+	require.Equal(t, "applied", ds.Delegations[0].Status)
+	require.Equal(t, "failed", ds.Delegations[1].Status)
+
+	require.Len(t, ds.Blocks, 2)
+	require.Equal(t, ds.Delegations[0].Block, ds.Blocks[0].Hash)
+	require.Equal(t, "BLb", ds.Blocks[1].Hash)
+	require.True(t, time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC).Equal(ds.Blocks[1].Timestamp))
+}
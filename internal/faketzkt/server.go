@@ -0,0 +1,343 @@
+// Package faketzkt serves a TzKT-compatible API from an in-memory dataset,
+// so the service can be developed and tested without network access.
+//
+// It implements the subset of the TzKT v1 API the service uses:
+// /v1/operations/delegations, /v1/operations/delegations/count,
+// /v1/operations/staking, /v1/blocks and /v1/head, with the query parameters
+// the client sends. Latency, 429 and 5xx
+// responses can be injected to exercise the client's retries, limiter and
+// circuit breaker.
+package faketzkt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// maxLimit is the largest page size TzKT accepts.
+const maxLimit = 10000
+
+// Faults configures the failures injected into responses.
+type Faults struct {
+	// Latency delays every response.
+	Latency time.Duration
+	// RateLimitRate is the share of requests, in [0, 1], answered with 429.
+	RateLimitRate float64
+	// RetryAfter is sent with injected 429s when positive.
+	RetryAfter time.Duration
+	// ErrorRate is the share of requests, in [0, 1], answered with a 502, 503 or 504.
+	ErrorRate float64
+	// Seed makes the injected failures reproducible.
+	Seed uint64
+}
+
+// Server is an http.Handler serving a Dataset like the TzKT API does.
+type Server struct {
+	ds     Dataset
+	faults Faults
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewServer(ds Dataset, faults Faults) *Server {
+	return &Server{ds: ds, faults: faults, rng: rand.New(rand.NewPCG(faults.Seed, faults.Seed))}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.faults.Latency > 0 {
+		select {
+		case <-time.After(s.faults.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if s.fail(w) {
+		return
+	}
+
+	// TzKT reports the level it has indexed on every response.
+	if len(s.ds.Blocks) > 0 {
+		w.Header().Set("Tzkt-Level", strconv.FormatInt(s.ds.Blocks[len(s.ds.Blocks)-1].Level, 10))
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/v1/operations/delegations":
+		s.handleDelegations(w, r.URL.Query())
+	case "/v1/operations/delegations/count":
+		s.handleDelegationCount(w, r.URL.Query())
+	case "/v1/operations/staking":
+		s.handleStaking(w, r.URL.Query())
+	case "/v1/blocks":
+		s.handleBlocks(w, r.URL.Query())
+	case "/v1/head":
+		s.handleHead(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fail writes an injected failure, reporting whether it did.
+func (s *Server) fail(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	roll := s.rng.Float64()
+	code := []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}[s.rng.IntN(3)]
+	s.mu.Unlock()
+
+	switch {
+	case roll < s.faults.RateLimitRate:
+		if s.faults.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.faults.RetryAfter.Round(time.Second)/time.Second)))
+		}
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return true
+	case roll < s.faults.RateLimitRate+s.faults.ErrorRate:
+		http.Error(w, http.StatusText(code), code)
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) handleDelegations(w http.ResponseWriter, q url.Values) {
+	filters, err := delegationFilters(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sortField, desc, err := sortOrder(q, "id", "id", "level", "timestamp")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := limitParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := []Delegation{}
+	for _, d := range s.ds.Delegations {
+		if matches(d, filters) {
+			out = append(out, d)
+		}
+	}
+	// Delegations are stored by id; a stable sort keeps that order among
+	// delegations sharing a level or timestamp.
+	if sortField != "id" {
+		key := func(d Delegation) int64 { return d.Level }
+		if sortField == "timestamp" {
+			key = func(d Delegation) int64 { return d.Timestamp.Unix() }
+		}
+		sort.SliceStable(out, func(i, j int) bool { return key(out[i]) < key(out[j]) })
+	}
+	if desc {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	writeJSON(w, out)
+}
+
+// handleDelegationCount counts the delegations matching the same filters as
+// handleDelegations.
+func (s *Server) handleDelegationCount(w http.ResponseWriter, q url.Values) {
+	filters, err := delegationFilters(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n := 0
+	for _, d := range s.ds.Delegations {
+		if matches(d, filters) {
+			n++
+		}
+	}
+	writeJSON(w, n)
+}
+
+// handleStaking serves the staking operations after an id, as the staking
+// poller requests them.
+func (s *Server) handleStaking(w http.ResponseWriter, q url.Values) {
+	afterID, maxLevel := int64(0), int64(math.MaxInt64)
+	for key := range q {
+		value := q.Get(key)
+		switch key {
+		case "id.gt", "level.le":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s", key), http.StatusBadRequest)
+				return
+			}
+			if key == "id.gt" {
+				afterID = n
+			} else {
+				maxLevel = n
+			}
+		case "status":
+			// Every staking operation of a dataset is applied.
+			if value != "applied" {
+				writeJSON(w, []tzkt.StakingOperation{})
+				return
+			}
+		case "sort.asc":
+			if value != "id" {
+				http.Error(w, "only sort.asc=id is supported", http.StatusBadRequest)
+				return
+			}
+		case "limit":
+		default:
+			http.Error(w, fmt.Sprintf("unsupported parameter %s", key), http.StatusBadRequest)
+			return
+		}
+	}
+	limit, err := limitParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := []tzkt.StakingOperation{}
+	for _, op := range s.ds.Staking {
+		if op.ID > afterID && op.Level <= maxLevel && len(out) < limit {
+			out = append(out, op)
+		}
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) handleBlocks(w http.ResponseWriter, q url.Values) {
+	from := int64(0)
+	if v := q.Get("level.ge"); v != "" {
+		var err error
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid level.ge", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, desc, err := sortOrder(q, "level", "level"); err != nil || desc {
+		http.Error(w, "only sort.asc=level is supported", http.StatusBadRequest)
+		return
+	}
+	limit, err := limitParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := []tzkt.Block{}
+	for _, b := range s.ds.Blocks {
+		if b.Level >= from && len(out) < limit {
+			out = append(out, b)
+		}
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) handleHead(w http.ResponseWriter) {
+	if len(s.ds.Blocks) == 0 {
+		writeJSON(w, tzkt.Block{})
+		return
+	}
+	writeJSON(w, s.ds.Blocks[len(s.ds.Blocks)-1])
+}
+
+// filter is a single query filter on a delegation.
+type filter func(Delegation) bool
+
+func delegationFilters(q url.Values) ([]filter, error) {
+	var out []filter
+	for key := range q {
+		value := q.Get(key)
+		switch key {
+		case "id", "id.gt", "level", "level.ge", "level.lt":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			switch key {
+			case "id":
+				out = append(out, func(d Delegation) bool { return d.ID == n })
+			case "id.gt":
+				out = append(out, func(d Delegation) bool { return d.ID > n })
+			case "level":
+				out = append(out, func(d Delegation) bool { return d.Level == n })
+			case "level.ge":
+				out = append(out, func(d Delegation) bool { return d.Level >= n })
+			case "level.lt":
+				out = append(out, func(d Delegation) bool { return d.Level < n })
+			}
+		case "timestamp.gt":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp.gt")
+			}
+			out = append(out, func(d Delegation) bool { return d.Timestamp.After(t) })
+		case "status":
+			out = append(out, func(d Delegation) bool { return d.Status == value })
+		case "sort.asc", "sort.desc", "limit", "select.fields":
+		default:
+			return nil, fmt.Errorf("unsupported parameter %s", key)
+		}
+	}
+	return out, nil
+}
+
+func matches(d Delegation, filters []filter) bool {
+	for _, f := range filters {
+		if !f(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortOrder returns the requested sort field and direction, def when none is given.
+func sortOrder(q url.Values, def string, allowed ...string) (string, bool, error) {
+	field, desc := def, false
+	if v := q.Get("sort.asc"); v != "" {
+		field = v
+	} else if v := q.Get("sort.desc"); v != "" {
+		field, desc = v, true
+	}
+	for _, a := range allowed {
+		if field == a {
+			return field, desc, nil
+		}
+	}
+	return "", false, fmt.Errorf("unsupported sort field %s", field)
+}
+
+func limitParam(q url.Values) (int, error) {
+	v := q.Get("limit")
+	if v == "" {
+		return 100, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > maxLimit {
+		return 0, fmt.Errorf("invalid limit")
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,172 @@
+package faketzkt
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/tzkt"
+)
+
+var genesis = time.Date(2018, 6, 30, 0, 0, 0, 0, time.UTC)
+
+func newClient(t *testing.T, ds Dataset, faults Faults) tzkt.Client {
+	srv := httptest.NewServer(NewServer(ds, faults))
+	t.Cleanup(srv.Close)
+	return tzkt.NewClient(srv.URL+"/v1", 2*time.Second)
+}
+
+func TestServer_PagesLikeTzKT(t *testing.T) {
+	ds := Synthetic(500, genesis, 1)
+	c := newClient(t, ds, Faults{})
+	ctx := context.Background()
+
+	failed := 0
+	for _, d := range ds.Delegations {
+		if d.Status == "failed" {
+			failed++
+		}
+	}
+	require.Positive(t, failed, "the dataset has failed delegations")
+
+	page, err := c.FetchDelegations(ctx, genesis, 100)
+	require.NoError(t, err)
+	require.Len(t, page, 100)
+	require.Equal(t, ds.Delegations[0].ID, page[0].ID)
+
+	// Paging by id visits every delegation exactly once, whatever its status.
+	var got []tzkt.Delegation
+	got = append(got, page...)
+	for len(page) == 100 {
+		page, err = c.FetchDelegationsAfterID(ctx, got[len(got)-1].ID, 100)
+		require.NoError(t, err)
+		got = append(got, page...)
+	}
+	require.Len(t, got, len(ds.Delegations))
+	for i, d := range ds.Delegations {
+		require.Equal(t, d.ID, got[i].ID)
+		require.Equal(t, d.Status, got[i].Status)
+		if d.Status == "failed" {
+			require.NotEmpty(t, got[i].Errors)
+		}
+	}
+}
+
+func TestServer_FiltersByTimestampAndLevel(t *testing.T) {
+	ds := Synthetic(200, genesis, 2)
+	c := newClient(t, ds, Faults{})
+	ctx := context.Background()
+
+	mid := ds.Delegations[100]
+	page, err := c.FetchDelegations(ctx, mid.Timestamp, 10000)
+	require.NoError(t, err)
+	for _, d := range page {
+		require.True(t, d.Timestamp.After(mid.Timestamp))
+	}
+
+	atLevel, err := c.FetchDelegationsAtLevel(ctx, mid.Level)
+	require.NoError(t, err)
+	for _, d := range atLevel {
+		require.Equal(t, mid.Level, d.Level)
+	}
+
+	inRange, err := c.FetchDelegationsInRange(ctx, mid.Level, mid.Level+50, 0, 10000)
+	require.NoError(t, err)
+	require.NotEmpty(t, inRange)
+	for _, d := range inRange {
+		require.GreaterOrEqual(t, d.Level, mid.Level)
+		require.Less(t, d.Level, mid.Level+50)
+	}
+
+	count, err := c.CountDelegationsInRange(ctx, mid.Level, mid.Level+50)
+	require.NoError(t, err)
+	require.Equal(t, len(inRange), count)
+}
+
+func TestServer_BlocksAndHead(t *testing.T) {
+	ds := Synthetic(50, genesis, 3)
+	c := newClient(t, ds, Faults{})
+	ctx := context.Background()
+
+	head, err := c.FetchHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ds.Blocks[len(ds.Blocks)-1], head)
+
+	d := ds.Delegations[10]
+	blocks, err := c.FetchBlocks(ctx, d.Level, 3)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	require.Equal(t, d.Level, blocks[0].Level)
+	require.Equal(t, d.Block, blocks[0].Hash, "delegations point at the blocks served")
+}
+
+func TestServer_PagesStaking(t *testing.T) {
+	ds := Synthetic(500, genesis, 4)
+	require.NotEmpty(t, ds.Staking)
+	c := newClient(t, ds, Faults{})
+	ctx := context.Background()
+
+	var got []tzkt.StakingOperation
+	for {
+		afterID := int64(0)
+		if len(got) > 0 {
+			afterID = got[len(got)-1].ID
+		}
+		page, err := c.FetchStakingAfterID(ctx, afterID, math.MaxInt64, 10)
+		require.NoError(t, err)
+		got = append(got, page...)
+		if len(page) < 10 {
+			break
+		}
+	}
+	require.Equal(t, ds.Staking, got)
+
+	// Operations above maxLevel are left for later.
+	last := ds.Staking[len(ds.Staking)-1]
+	page, err := c.FetchStakingAfterID(ctx, 0, last.Level-1, maxLimit)
+	require.NoError(t, err)
+	require.Less(t, len(page), len(ds.Staking))
+	for _, op := range page {
+		require.Less(t, op.Level, last.Level)
+	}
+}
+
+func TestServer_InjectsFaults(t *testing.T) {
+	srv := httptest.NewServer(NewServer(Synthetic(10, genesis, 4), Faults{
+		RateLimitRate: 0.5,
+		RetryAfter:    2 * time.Second,
+		ErrorRate:     0.5,
+	}))
+	defer srv.Close()
+
+	codes := make(map[int]int)
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(srv.URL + "/v1/head")
+		require.NoError(t, err)
+		resp.Body.Close()
+		codes[resp.StatusCode]++
+		if resp.StatusCode == http.StatusTooManyRequests {
+			require.Equal(t, "2", resp.Header.Get("Retry-After"))
+		}
+	}
+	require.Zero(t, codes[http.StatusOK])
+	require.Positive(t, codes[http.StatusTooManyRequests])
+	require.Positive(t, codes[http.StatusBadGateway]+codes[http.StatusServiceUnavailable]+codes[http.StatusGatewayTimeout])
+}
+
+func TestServer_RejectsUnsupportedParameters(t *testing.T) {
+	srv := httptest.NewServer(NewServer(Synthetic(10, genesis, 5), Faults{}))
+	defer srv.Close()
+
+	for _, query := range []string{"id.gt=abc", "limit=10001", "sort.asc=amount", "sender=tz1"} {
+		resp, err := http.Get(srv.URL + "/v1/operations/delegations?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
@@ -0,0 +1,188 @@
+// Package fixture records HTTP responses to files and replays them offline.
+//
+// A Recorder wraps a real transport and saves every response it sees; a
+// Replayer serves those files back without touching the network. Requests
+// are matched on method, path and query, ignoring the host, so traffic
+// recorded against the public TzKT API replays against any base URL with the
+// same path. Identical requests are numbered in the order they were made,
+// which lets a replay reproduce a sequence such as a 503 followed by a
+// successful retry.
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Exchange is a recorded request and its response, as stored on disk.
+type Exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// JSON holds the body when it is valid JSON, Text otherwise, so that
+	// recordings stay readable and editable.
+	JSON json.RawMessage `json:"json,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// counter numbers identical requests per key.
+type counter struct {
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+func (c *counter) next(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]int)
+	}
+	c.seen[key]++
+	return c.seen[key]
+}
+
+// Recorder is an http.RoundTripper that saves every response to dir.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+	seq  counter
+}
+
+// NewRecorder returns a Recorder sending requests through next, or through
+// http.DefaultTransport when next is nil.
+func NewRecorder(dir string, next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, next: next}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("fixture: read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	ex := Exchange{
+		Method: req.Method,
+		URL:    requestURL(req),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, body, "", "  ") == nil {
+		ex.JSON = indented.Bytes()
+	} else {
+		ex.Text = string(body)
+	}
+	// The body is stored decoded, so its transfer headers no longer apply.
+	ex.Header.Del("Content-Length")
+	ex.Header.Del("Content-Encoding")
+
+	data, err := json.MarshalIndent(ex, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("fixture: encode exchange: %w", err)
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("fixture: create directory: %w", err)
+	}
+	key := fileKey(req)
+	path := filepath.Join(r.dir, fileName(key, r.seq.next(key)))
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("fixture: write %s: %w", path, err)
+	}
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that serves responses recorded in dir.
+// Once the recordings of a request are exhausted, the last one is served
+// again, so a replay stays deterministic however often a request is repeated.
+type Replayer struct {
+	dir string
+	seq counter
+}
+
+func NewReplayer(dir string) *Replayer {
+	return &Replayer{dir: dir}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := fileKey(req)
+	n := r.seq.next(key)
+
+	data, err := os.ReadFile(filepath.Join(r.dir, fileName(key, n)))
+	for os.IsNotExist(err) && n > 1 {
+		n--
+		data, err = os.ReadFile(filepath.Join(r.dir, fileName(key, n)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fixture: no recording of %s %s in %s: %w", req.Method, requestURL(req), r.dir, err)
+	}
+
+	var ex Exchange
+	if err := json.Unmarshal(data, &ex); err != nil {
+		return nil, fmt.Errorf("fixture: decode %s: %w", fileName(key, n), err)
+	}
+	body := []byte(ex.Text)
+	if len(ex.JSON) > 0 {
+		body = ex.JSON
+	}
+	header := ex.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		StatusCode:    ex.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// requestURL is the part of the request URL a recording is matched on.
+func requestURL(req *http.Request) string {
+	u := req.URL.Path
+	if q := req.URL.Query().Encode(); q != "" {
+		u += "?" + q
+	}
+	return u
+}
+
+// fileKey names the recordings of a request: a readable prefix from the
+// method and path, and a hash of the full URL to tell queries apart.
+func fileKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + requestURL(req)))
+	path := strings.Trim(req.URL.Path, "/")
+	path = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, path)
+	return strings.ToLower(req.Method) + "_" + path + "_" + hex.EncodeToString(sum[:])[:12]
+}
+
+func fileName(key string, n int) string {
+	return fmt.Sprintf("%s_%d.json", key, n)
+}
@@ -0,0 +1,70 @@
+package fixture
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, c *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.URL.Path == "/v1/head" && calls == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("busy"))
+		case r.URL.Path == "/v1/head":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"level":42}`))
+		default:
+			_, _ = w.Write([]byte(`[{"id":` + r.URL.Query().Get("id.gt") + `}]`))
+		}
+	}))
+
+	dir := t.TempDir()
+	recording := &http.Client{Transport: NewRecorder(dir, nil)}
+	status, body := get(t, recording, srv.URL+"/v1/head")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "busy", body)
+	status, body = get(t, recording, srv.URL+"/v1/head")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, `{"level":42}`, body)
+	_, body = get(t, recording, srv.URL+"/v1/operations/delegations?id.gt=1&limit=2")
+	require.Equal(t, `[{"id":1}]`, body)
+	srv.Close()
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	// Replays in order, on any host, with the query in any order.
+	replaying := &http.Client{Transport: NewReplayer(dir)}
+	status, body = get(t, replaying, "http://fixtures/v1/head")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "busy", body)
+	for i := 0; i < 2; i++ {
+		status, body = get(t, replaying, "http://fixtures/v1/head")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"level":42}`, body)
+	}
+	_, body = get(t, replaying, "http://fixtures/v1/operations/delegations?limit=2&id.gt=1")
+	require.JSONEq(t, `[{"id":1}]`, body)
+
+	_, err = replaying.Get("http://fixtures/v1/operations/delegations?id.gt=2&limit=2")
+	require.ErrorContains(t, err, "no recording of GET /v1/operations/delegations?id.gt=2&limit=2")
+}
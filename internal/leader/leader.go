@@ -0,0 +1,174 @@
+// Package leader elects one replica of the service to run ingestion, using a
+// Postgres advisory lock. The lock belongs to a database session, so it is
+// released as soon as the leader stops or its connection drops, and another
+// replica takes over.
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultKey is the advisory lock key of the ingestion leader.
+const DefaultKey int64 = 0x7a74786c656164 // "ztxlead"
+
+// Roles reported by an Elector.
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// Elector campaigns for an advisory lock and runs work while it holds it.
+type Elector struct {
+	db  *sql.DB
+	key int64
+	// interval is how often a follower tries to take the lock, and how often
+	// the leader checks that its session, and with it the lock, is alive.
+	interval time.Duration
+	logger   *log.Logger
+
+	leader atomic.Bool
+}
+
+// Option configures optional features of an Elector.
+type Option func(*Elector)
+
+// WithInterval sets how often the lock is tried and checked, 5s by default.
+func WithInterval(d time.Duration) Option {
+	return func(e *Elector) {
+		e.interval = d
+	}
+}
+
+// WithLogger logs elections to l instead of the default logger.
+func WithLogger(l *log.Logger) Option {
+	return func(e *Elector) {
+		e.logger = l
+	}
+}
+
+// New returns an Elector for the advisory lock key on db.
+func New(db *sql.DB, key int64, opts ...Option) *Elector {
+	e := &Elector{db: db, key: key, interval: 5 * time.Second, logger: log.Default()}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Role returns RoleLeader while this replica holds the lock, RoleFollower otherwise.
+func (e *Elector) Role() string {
+	if e.leader.Load() {
+		return RoleLeader
+	}
+	return RoleFollower
+}
+
+// Run campaigns for leadership until ctx is done. Whenever it wins, it runs
+// work with a context that is cancelled when leadership is lost, and
+// campaigns again once work returns. An error returned by work ends Run.
+func (e *Elector) Run(ctx context.Context, work func(context.Context) error) error {
+	for {
+		conn, err := e.acquire(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			e.logger.Printf("leader election: %v", err)
+		case conn != nil:
+			if err := e.lead(ctx, conn, work); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-time.After(e.interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// acquire tries to take the lock on a dedicated connection, and returns that
+// connection if it did.
+func (e *Elector) acquire(ctx context.Context) (*sql.Conn, error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get connection: %w", err)
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, e.key).Scan(&locked); err != nil {
+		discard(conn)
+		return nil, fmt.Errorf("try advisory lock: %w", err)
+	}
+	if !locked {
+		_ = conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// lead runs work while conn holds the lock, and gives the lock up when work
+// returns or the session can no longer be reached.
+func (e *Elector) lead(ctx context.Context, conn *sql.Conn, work func(context.Context) error) error {
+	e.leader.Store(true)
+	defer e.leader.Store(false)
+	e.logger.Printf("leader election: elected leader")
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- work(workCtx)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			e.release(conn)
+			if err != nil {
+				return err
+			}
+			return nil
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, e.interval)
+			err := conn.PingContext(pingCtx)
+			pingCancel()
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			// Another replica may take over once the session is gone: stop
+			// working before it starts.
+			e.logger.Printf("leader election: lost the lock session: %v", err)
+			cancel()
+			err = <-done
+			discard(conn)
+			return err
+		}
+	}
+}
+
+// release unlocks and returns the connection to the pool.
+func (e *Elector) release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, e.key); err != nil {
+		// Closing the session releases the lock too.
+		discard(conn)
+		return
+	}
+	_ = conn.Close()
+	e.logger.Printf("leader election: stepped down")
+}
+
+// discard closes the session of conn rather than returning it to the pool,
+// where it could keep holding the lock.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
@@ -0,0 +1,191 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// runBackfill runs the historical backfill until it completes or ctx is done,
+// retrying with backoff on errors. A backfill only starts on an empty
+// checkpoint, so it is skipped once the live poller has taken over.
+func (p *Poller) runBackfill(ctx context.Context) {
+	backoff := p.cfg.PollInterval
+
+	for {
+		state, err := p.cfg.Store.GetSyncState(ctx, syncStateName)
+		if err == nil {
+			if state.CursorID != 0 {
+				return
+			}
+			err = p.backfill(ctx)
+		}
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		p.cfg.Logger.Printf("backfill error: %v", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff < p.cfg.MaxBackoff {
+			backoff *= 2
+			if backoff > p.cfg.MaxBackoff {
+				backoff = p.cfg.MaxBackoff
+			}
+		}
+	}
+}
+
+// backfill splits history up to the current head into level ranges and syncs
+// them concurrently. Workers share the client, and with it the TzKT rate
+// limiter, so the worker count bounds concurrency, not request rate. Each
+// range keeps its own checkpoint, so an interrupted backfill resumes where it
+// stopped. Once every range is done, the sync checkpoint is moved to the last
+// backfilled operation and the live poller carries on from there.
+func (p *Poller) backfill(ctx context.Context) error {
+	ranges, err := p.cfg.Store.GetBackfillRanges(ctx, syncStateName)
+	if err != nil {
+		return fmt.Errorf("get backfill ranges: %w", err)
+	}
+
+	if len(ranges) == 0 {
+		head, err := p.cfg.Client.FetchHead(ctx)
+		if err != nil {
+			return fmt.Errorf("fetch head: %w", err)
+		}
+		// Stop short of the reorg window so that recent blocks are synced,
+		// and checked, by the live poller.
+		end := head.Level - int64(p.cfg.ReorgWindow) + 1
+		start, err := p.startLevel(ctx, end)
+		if err != nil {
+			return err
+		}
+		ranges = planRanges(start, end, p.cfg.BackfillRangeSize)
+		if err := p.cfg.Store.CreateBackfillRanges(ctx, syncStateName, ranges); err != nil {
+			return fmt.Errorf("create backfill ranges: %w", err)
+		}
+		// History is paged by id from the start, so there are no timestamp
+		// cursor boundaries to repair.
+		if err := p.cfg.Store.MarkRepairDone(ctx, boundaryRepair); err != nil {
+			return err
+		}
+		p.cfg.Logger.Printf("backfill: planned %d ranges of %d levels up to level %d", len(ranges), p.cfg.BackfillRangeSize, end)
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(p.cfg.BackfillWorkers)
+	for _, r := range ranges {
+		if r.Done {
+			continue
+		}
+		g.Go(func() error {
+			return p.backfillRange(gCtx, r)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	// Reload the checkpoints to find the last backfilled operation.
+	ranges, err = p.cfg.Store.GetBackfillRanges(ctx, syncStateName)
+	if err != nil {
+		return fmt.Errorf("get backfill ranges: %w", err)
+	}
+	handoff := store.SyncState{Name: syncStateName}
+	for _, r := range ranges {
+		if r.CursorID > handoff.CursorID {
+			handoff.CursorID = r.CursorID
+		}
+		if r.ToLevel-1 > handoff.Level {
+			handoff.Level = r.ToLevel - 1
+		}
+	}
+	if handoff.CursorID == 0 {
+		// Nothing to hand off: the live poller starts from GenesisStart.
+		return nil
+	}
+	if err := p.cfg.Store.SaveBatch(ctx, nil, handoff); err != nil {
+		return fmt.Errorf("hand off to live poller: %w", err)
+	}
+	p.cfg.Logger.Printf("backfill: completed up to level %d, live polling after id %d", handoff.Level, handoff.CursorID)
+	return nil
+}
+
+// startLevel returns the level the backfill starts at: BackfillStartLevel if
+// set, otherwise the level of the first delegation after GenesisStart, or end
+// if there is none yet.
+func (p *Poller) startLevel(ctx context.Context, end int64) (int64, error) {
+	if p.cfg.BackfillStartLevel > 0 || p.cfg.GenesisStart.IsZero() {
+		return p.cfg.BackfillStartLevel, nil
+	}
+	level, err := firstLevel(ctx, p.cfg.Client, p.cfg.GenesisStart)
+	if err != nil {
+		return 0, err
+	}
+	if level == 0 {
+		return end, nil
+	}
+	return level, nil
+}
+
+// firstLevel returns the level of the first delegation after since, or 0 if
+// there is none yet.
+func firstLevel(ctx context.Context, client tzkt.Client, since time.Time) (int64, error) {
+	first, err := client.FetchDelegations(ctx, since, 1)
+	if err != nil {
+		return 0, fmt.Errorf("find first level since %s: %w", since.UTC().Format(time.RFC3339), err)
+	}
+	if len(first) == 0 {
+		return 0, nil
+	}
+	return first[0].Level, nil
+}
+
+// backfillRange pages through a single level range by operation id. Each page
+// is streamed from TzKT and saved ChunkSize delegations at a time, advancing
+// the range checkpoint with every chunk.
+func (p *Poller) backfillRange(ctx context.Context, r store.BackfillRange) error {
+	for !r.Done {
+		afterID := r.CursorID
+		n, err := p.cfg.Client.StreamDelegationsInRange(ctx, r.FromLevel, r.ToLevel, afterID, p.cfg.BatchSize, p.cfg.ChunkSize, func(chunk []tzkt.Delegation) error {
+			r.CursorID = chunk[len(chunk)-1].ID
+			batch := toInsertBatch(chunk)
+			if err := p.cfg.Store.SaveBackfillBatch(ctx, syncStateName, batch, r); err != nil {
+				return fmt.Errorf("save backfill batch of %d delegations: %w", len(batch), err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("stream delegations in levels %d-%d after id %d: %w", r.FromLevel, r.ToLevel, afterID, err)
+		}
+		if n < p.cfg.BatchSize {
+			r.Done = true
+			if err := p.cfg.Store.SaveBackfillBatch(ctx, syncStateName, nil, r); err != nil {
+				return fmt.Errorf("mark range %d-%d done: %w", r.FromLevel, r.ToLevel, err)
+			}
+		}
+	}
+	p.cfg.Logger.Printf("backfill: range %d-%d done", r.FromLevel, r.ToLevel)
+	return nil
+}
+
+// planRanges splits [from, to) into consecutive ranges of at most size levels.
+func planRanges(from, to, size int64) []store.BackfillRange {
+	var out []store.BackfillRange
+	for lvl := from; lvl < to; lvl += size {
+		end := lvl + size
+		if end > to {
+			end = to
+		}
+		out = append(out, store.BackfillRange{FromLevel: lvl, ToLevel: end})
+	}
+	return out
+}
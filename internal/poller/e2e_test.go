@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/fixture"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// These tests run the poller against the real TzKT client, replaying TzKT
+// responses recorded in testdata/fixtures, so that HTTP, decoding and retries
+// are exercised without network access.
+
+func replayClient(dir string) tzkt.Client {
+	return tzkt.NewClient("http://tzkt.fixtures/v1", 2*time.Second, tzkt.WithTransport(fixture.NewReplayer(dir)))
+}
+
+func TestE2E_SyncsFromGenesisThroughRetries(t *testing.T) {
+	st := &mockStore{}
+	p := NewPoller(Config{
+		Store:        st,
+		Client:       replayClient("testdata/fixtures/sync"),
+		BatchSize:    2,
+		GenesisStart: time.Date(2018, 6, 30, 0, 0, 0, 0, time.UTC),
+		ReorgWindow:  2,
+		Logger:       log.New(io.Discard, "", 0),
+	})
+	ctx := context.Background()
+
+	// The first request is answered with a 503 and retried.
+	n, err := p.syncOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	n, err = p.syncOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	n, err = p.syncOnce(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	require.Len(t, st.insert, 3)
+	first := st.insert[0]
+	require.Equal(t, int64(1098907648), first.TzktID)
+	require.Equal(t, "tz1Wit2PqodvPeuRRhdQXmkrtU8e8bRYZecd", first.Delegator)
+	require.Equal(t, int64(1000000000), first.Amount)
+	require.Equal(t, "tz3RDC3Jdn4j15J7bBHZd29EUee9gVB1CxD9", first.Baker)
+	require.Equal(t, "Foundation Baker 1", first.BakerAlias)
+	require.Empty(t, first.PreviousBaker)
+
+	undelegation := st.insert[2]
+	require.Empty(t, undelegation.Baker)
+	require.Equal(t, "tz3RDC3Jdn4j15J7bBHZd29EUee9gVB1CxD9", undelegation.PreviousBaker)
+
+	require.Equal(t, int64(1127743488), st.state.CursorID)
+	require.Equal(t, int64(190), st.state.Level)
+	require.Equal(t, "BLf6iG8ezrLRyUJYrVa7c5N8VGgxxtRpTYXYAbmFyCtnkHCWPRA", st.blocks[190].Hash)
+}
@@ -11,29 +11,59 @@ import (
 )
 
 type Config struct {
-	Store        store.DelegationStore
-	Client       tzkt.Client
-	BatchSize    int
+	Store     store.DelegationStore
+	Client    tzkt.Client
+	BatchSize int
+	// ChunkSize is the number of delegations the backfill decodes and saves
+	// at a time, bounding its memory whatever BatchSize is. The live poller
+	// still fetches whole BatchSize pages.
+	ChunkSize    int
 	PollInterval time.Duration
 	GenesisStart time.Time
 	MaxBackoff   time.Duration
-	Logger       *log.Logger
+	// ReorgWindow is the number of levels below the synced head whose block
+	// hashes are checked against TzKT on every cycle. Zero disables the check.
+	ReorgWindow int
+	// BackfillWorkers is the number of level ranges synced concurrently when
+	// starting from an empty checkpoint. Zero disables the parallel backfill.
+	BackfillWorkers   int
+	BackfillRangeSize int64
+	// BackfillStartLevel is the first level backfilled. When zero, the
+	// backfill starts at the level of the first delegation after GenesisStart.
+	BackfillStartLevel int64
+	// Subscriber, when set, streams new delegations from the TzKT events hub
+	// instead of polling every PollInterval.
+	Subscriber tzkt.Subscriber
+	// StreamRetryInterval is how long the poller falls back to polling after
+	// the event stream drops, before reconnecting.
+	StreamRetryInterval time.Duration
+	Logger              *log.Logger
 }
 
 type Poller struct {
-	cfg Config
+	cfg      Config
+	repaired bool
 }
 
 func NewPoller(cfg Config) *Poller {
 	if cfg.BatchSize <= 0 {
 		cfg.BatchSize = 10000
 	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 1000
+	}
 	if cfg.PollInterval <= 0 {
 		cfg.PollInterval = 15 * time.Second
 	}
 	if cfg.MaxBackoff <= 0 {
 		cfg.MaxBackoff = 2 * time.Minute
 	}
+	if cfg.BackfillRangeSize <= 0 {
+		cfg.BackfillRangeSize = 100000
+	}
+	if cfg.StreamRetryInterval <= 0 {
+		cfg.StreamRetryInterval = time.Minute
+	}
 	if cfg.Logger == nil {
 		cfg.Logger = log.Default()
 	}
@@ -41,12 +71,32 @@ func NewPoller(cfg Config) *Poller {
 }
 
 func (p *Poller) Run(ctx context.Context) error {
+	if p.cfg.BackfillWorkers > 0 {
+		p.runBackfill(ctx)
+	}
+
+	if p.cfg.Subscriber != nil {
+		p.stream(ctx)
+		return nil
+	}
+	p.poll(ctx)
+	return nil
+}
+
+// SyncState returns the checkpoint of the poller, zero until its first batch.
+func (p *Poller) SyncState(ctx context.Context) (store.SyncState, error) {
+	return p.cfg.Store.GetSyncState(ctx, syncStateName)
+}
+
+// poll runs sync cycles until ctx is done, waiting PollInterval whenever it
+// has caught up and backing off on errors.
+func (p *Poller) poll(ctx context.Context) {
 	backoff := p.cfg.PollInterval
 
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return
 		default:
 		}
 
@@ -56,7 +106,7 @@ func (p *Poller) Run(ctx context.Context) error {
 			select {
 			case <-time.After(backoff):
 			case <-ctx.Done():
-				return nil
+				return
 			}
 			if backoff < p.cfg.MaxBackoff {
 				backoff *= 2
@@ -76,47 +126,223 @@ func (p *Poller) Run(ctx context.Context) error {
 		select {
 		case <-time.After(p.cfg.PollInterval):
 		case <-ctx.Done():
-			return nil
+			return
 		}
 	}
 }
 
+// boundaryRepair names the one-time pass that refetches the blocks where
+// batches ended while the poller still paged by timestamp.
+const boundaryRepair = "timestamp-cursor-boundaries"
+
+// syncStateName is the checkpoint the poller reads and advances in sync_state.
+const syncStateName = "delegations"
+
 func (p *Poller) syncOnce(ctx context.Context) (int, error) {
-	lastTs, _, err := p.cfg.Store.GetLastSeen(ctx)
+	if !p.repaired {
+		if err := p.repairBoundaries(ctx); err != nil {
+			return 0, fmt.Errorf("repair boundary blocks: %w", err)
+		}
+		p.repaired = true
+	}
+
+	state, err := p.cfg.Store.GetSyncState(ctx, syncStateName)
 	if err != nil {
-		return 0, fmt.Errorf("get last seen: %w", err)
+		return 0, fmt.Errorf("get sync state: %w", err)
 	}
 
-	if lastTs.IsZero() || (!p.cfg.GenesisStart.IsZero() && lastTs.Before(p.cfg.GenesisStart)) {
-		lastTs = p.cfg.GenesisStart
+	var delegations []tzkt.Delegation
+	if state.CursorID == 0 {
+		delegations, err = p.cfg.Client.FetchDelegations(ctx, p.cfg.GenesisStart, p.cfg.BatchSize)
+		if err != nil {
+			return 0, fmt.Errorf("fetch delegations since %s: %w", p.cfg.GenesisStart.UTC().Format(time.RFC3339), err)
+		}
+	} else {
+		delegations, err = p.cfg.Client.FetchDelegationsAfterID(ctx, state.CursorID, p.cfg.BatchSize)
+		if err != nil {
+			return 0, fmt.Errorf("fetch delegations after id %d: %w", state.CursorID, err)
+		}
 	}
 
-	delegations, err := p.cfg.Client.FetchDelegations(ctx, lastTs, p.cfg.BatchSize)
-	if err != nil {
-		return 0, fmt.Errorf("fetch delegations since %s: %w", lastTs.UTC().Format(time.RFC3339), err)
+	if p.cfg.ReorgWindow > 0 {
+		head := state.Level
+		if n := len(delegations); n > 0 && delegations[n-1].Level > head {
+			head = delegations[n-1].Level
+		}
+		if head > 0 {
+			forked, err := p.checkReorg(ctx, head, delegations)
+			if err != nil {
+				return 0, fmt.Errorf("check reorg at level %d: %w", head, err)
+			}
+			if forked {
+				return 0, nil
+			}
+		}
 	}
+
 	if len(delegations) == 0 {
 		return 0, nil
 	}
 
+	inserted, err := p.save(ctx, delegations)
+	if err != nil {
+		return 0, err
+	}
+
+	p.cfg.Logger.Printf("poller: inserted %d delegations after id %d", inserted, state.CursorID)
+	// Report the fetched count so Run keeps paging while TzKT returns full batches,
+	// even if a few rows were filtered out.
+	return len(delegations), nil
+}
+
+// save stores delegations, ordered by id, and moves the sync checkpoint to the
+// last one. It returns the number of rows stored.
+func (p *Poller) save(ctx context.Context, delegations []tzkt.Delegation) (int, error) {
+	// The cursor follows the last fetched operation, including any row
+	// filtered out of the batch, so it always moves forward.
+	last := delegations[len(delegations)-1]
+	next := store.SyncState{
+		Name:      syncStateName,
+		CursorID:  last.ID,
+		Level:     last.Level,
+		Timestamp: last.Timestamp,
+	}
+
+	batch := toInsertBatch(delegations)
+	if err := p.cfg.Store.SaveBatch(ctx, batch, next); err != nil {
+		return 0, fmt.Errorf("save batch of %d delegations: %w", len(batch), err)
+	}
+	return len(batch), nil
+}
+
+// repairBoundaries refetches the blocks where earlier timestamp-cursor batches
+// ended. Paging by timestamp.gt skipped the remaining operations of a block
+// whenever a batch boundary fell inside it; reinserting those blocks is safe
+// because BulkInsert ignores rows that are already stored.
+func (p *Poller) repairBoundaries(ctx context.Context) error {
+	done, err := p.cfg.Store.IsRepairDone(ctx, boundaryRepair)
+	if err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	levels, err := p.cfg.Store.GetBoundaryLevels(ctx)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, lvl := range levels {
+		delegations, err := p.cfg.Client.FetchDelegationsAtLevel(ctx, lvl)
+		if err != nil {
+			return fmt.Errorf("fetch delegations at level %d: %w", lvl, err)
+		}
+		batch := toInsertBatch(delegations)
+		if err := p.cfg.Store.BulkInsert(ctx, batch); err != nil {
+			return fmt.Errorf("bulk insert %d delegations at level %d: %w", len(batch), lvl, err)
+		}
+		total += len(batch)
+	}
+
+	if err := p.cfg.Store.MarkRepairDone(ctx, boundaryRepair); err != nil {
+		return err
+	}
+	p.cfg.Logger.Printf("poller: refetched %d boundary blocks (%d delegations)", len(levels), total)
+	return nil
+}
+
+// checkReorg compares the block hashes recorded for the head window ending at
+// head with the blocks TzKT currently has. On the first level whose hashes
+// differ it rolls the store back to the fork level, so the next cycle resyncs
+// from there, and reports true. Otherwise it records the current hashes. It
+// fails if TzKT has not indexed head yet, e.g. after failing over to a lagging
+// instance, or if it switched branches between returning delegations and
+// returning blocks, so that a batch from an orphaned block is never stored.
+func (p *Poller) checkReorg(ctx context.Context, head int64, delegations []tzkt.Delegation) (bool, error) {
+	from := head - int64(p.cfg.ReorgWindow) + 1
+	if from < 0 {
+		from = 0
+	}
+
+	remote, err := p.cfg.Client.FetchBlocks(ctx, from, p.cfg.ReorgWindow)
+	if err != nil {
+		return false, fmt.Errorf("fetch blocks from level %d: %w", from, err)
+	}
+	hashes := make(map[int64]string, len(remote))
+	blocks := make([]store.Block, 0, len(remote))
+	var top int64
+	for _, b := range remote {
+		if b.Level > head {
+			continue
+		}
+		hashes[b.Level] = b.Hash
+		blocks = append(blocks, store.Block{Level: b.Level, Hash: b.Hash, Timestamp: b.Timestamp})
+		top = max(top, b.Level)
+	}
+
+	local, err := p.cfg.Store.GetBlocksFrom(ctx, from)
+	if err != nil {
+		return false, fmt.Errorf("get blocks from level %d: %w", from, err)
+	}
+	for _, b := range local {
+		// A level TzKT did not return says nothing about a fork.
+		if hash, ok := hashes[b.Level]; !ok || hash == b.Hash {
+			continue
+		}
+		state, err := p.cfg.Store.Rollback(ctx, syncStateName, b.Level)
+		if err != nil {
+			return false, fmt.Errorf("rollback from level %d: %w", b.Level, err)
+		}
+		p.cfg.Logger.Printf("poller: chain reorganization at level %d, resyncing after id %d", b.Level, state.CursorID)
+		return true, nil
+	}
+	if top < head {
+		return false, fmt.Errorf("blocks end at level %d, before head %d", top, head)
+	}
+
+	for _, d := range delegations {
+		if hash, ok := hashes[d.Level]; ok && d.Block != "" && d.Block != hash {
+			return false, fmt.Errorf("block at level %d changed during sync", d.Level)
+		}
+	}
+
+	if err := p.cfg.Store.SaveBlocks(ctx, blocks); err != nil {
+		return false, fmt.Errorf("save blocks: %w", err)
+	}
+	if err := p.cfg.Store.PruneBlocks(ctx, from); err != nil {
+		return false, fmt.Errorf("prune blocks: %w", err)
+	}
+	return false, nil
+}
+
+func toInsertBatch(delegations []tzkt.Delegation) []store.InsertDelegation {
 	batch := make([]store.InsertDelegation, 0, len(delegations))
 	for _, d := range delegations {
 		if d.Sender.Address == "" {
 			continue
 		}
-		batch = append(batch, store.InsertDelegation{
+		row := store.InsertDelegation{
 			TzktID:    d.ID,
 			Timestamp: d.Timestamp,
 			Amount:    d.Amount,
 			Delegator: d.Sender.Address,
 			Level:     d.Level,
-		})
-	}
-
-	if err := p.cfg.Store.BulkInsert(ctx, batch); err != nil {
-		return 0, fmt.Errorf("bulk insert %d delegations: %w", len(batch), err)
+			Status:    d.Status,
+		}
+		for _, e := range d.Errors {
+			row.Errors = append(row.Errors, e.Type)
+		}
+		if d.NewDelegate != nil {
+			row.Baker = d.NewDelegate.Address
+			row.BakerAlias = d.NewDelegate.Alias
+		}
+		if d.PrevDelegate != nil {
+			row.PreviousBaker = d.PrevDelegate.Address
+			row.PreviousBakerAlias = d.PrevDelegate.Alias
+		}
+		batch = append(batch, row)
 	}
-
-	p.cfg.Logger.Printf("poller: inserted %d delegations since %s", len(batch), lastTs.UTC().Format(time.RFC3339))
-	return len(batch), nil
+	return batch
 }
@@ -2,41 +2,318 @@ package poller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"tezos-delegation-service/internal/store"
 	"tezos-delegation-service/internal/tzkt"
-	"github.com/stretchr/testify/require"
 )
 
 type mockStore struct {
-	lastTs time.Time
-	insert []store.InsertDelegation
+	mu         sync.Mutex
+	state      store.SyncState
+	boundaries []int64
+	repairs    map[string]bool
+	insert     []store.InsertDelegation
+	blocks     map[int64]store.Block
+	ranges     []store.BackfillRange
+	// backfillBatches holds the size of every batch saved by the backfill.
+	backfillBatches []int
 }
 
 func (m *mockStore) BulkInsert(_ context.Context, rows []store.InsertDelegation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.insert = append(m.insert, rows...)
 	return nil
 }
-func (m *mockStore) GetPage(context.Context, *int, int, int) ([]store.Delegation, error) {
+func (m *mockStore) GetPage(context.Context, store.DelegationFilter, int, int) ([]store.Delegation, error) {
+	return nil, nil
+}
+func (m *mockStore) GetPageAfter(context.Context, store.DelegationFilter, *store.PageCursor, int) ([]store.Delegation, error) {
+	return nil, nil
+}
+func (m *mockStore) GetDelegatorHistory(context.Context, string) ([]store.Delegation, error) {
+	return nil, nil
+}
+func (m *mockStore) GetBakerDelegators(context.Context, string, int, int) ([]store.Delegation, error) {
 	return nil, nil
 }
-func (m *mockStore) GetLastSeen(context.Context) (time.Time, int64, error) {
-	return m.lastTs, 0, nil
+func (m *mockStore) GetBakerEvents(context.Context, string, *int, int, int) ([]store.Delegation, error) {
+	return nil, nil
+}
+func (m *mockStore) SaveBatch(_ context.Context, rows []store.InsertDelegation, state store.SyncState) error {
+	m.insert = append(m.insert, rows...)
+	state.BatchCount = m.state.BatchCount + 1
+	m.state = state
+	return nil
+}
+func (m *mockStore) GetSyncState(_ context.Context, name string) (store.SyncState, error) {
+	if m.state.Name != name {
+		return store.SyncState{Name: name}, nil
+	}
+	return m.state, nil
+}
+func (m *mockStore) GetBoundaryLevels(context.Context) ([]int64, error) {
+	return m.boundaries, nil
+}
+func (m *mockStore) IsRepairDone(_ context.Context, name string) (bool, error) {
+	return m.repairs[name], nil
+}
+func (m *mockStore) MarkRepairDone(_ context.Context, name string) error {
+	if m.repairs == nil {
+		m.repairs = make(map[string]bool)
+	}
+	m.repairs[name] = true
+	return nil
+}
+
+func (m *mockStore) SaveBlocks(_ context.Context, blocks []store.Block) error {
+	if m.blocks == nil {
+		m.blocks = make(map[int64]store.Block)
+	}
+	for _, b := range blocks {
+		m.blocks[b.Level] = b
+	}
+	return nil
+}
+func (m *mockStore) GetBlocksFrom(_ context.Context, fromLevel int64) ([]store.Block, error) {
+	var out []store.Block
+	for lvl, b := range m.blocks {
+		if lvl >= fromLevel {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Level < out[j].Level })
+	return out, nil
+}
+func (m *mockStore) PruneBlocks(_ context.Context, belowLevel int64) error {
+	for lvl := range m.blocks {
+		if lvl < belowLevel {
+			delete(m.blocks, lvl)
+		}
+	}
+	return nil
+}
+func (m *mockStore) Rollback(_ context.Context, name string, fromLevel int64) (store.SyncState, error) {
+	kept := m.insert[:0]
+	for _, r := range m.insert {
+		if r.Level < fromLevel {
+			kept = append(kept, r)
+		}
+	}
+	m.insert = kept
+	for lvl := range m.blocks {
+		if lvl >= fromLevel {
+			delete(m.blocks, lvl)
+		}
+	}
+	m.state = store.SyncState{Name: name, BatchCount: m.state.BatchCount}
+	for _, r := range m.insert {
+		if r.TzktID > m.state.CursorID {
+			m.state.CursorID, m.state.Level, m.state.Timestamp = r.TzktID, r.Level, r.Timestamp
+		}
+	}
+	return m.state, nil
+}
+
+func (m *mockStore) CreateBackfillRanges(_ context.Context, _ string, ranges []store.BackfillRange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ranges = append(m.ranges, ranges...)
+	return nil
+}
+func (m *mockStore) GetBackfillRanges(context.Context, string) ([]store.BackfillRange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]store.BackfillRange(nil), m.ranges...), nil
+}
+func (m *mockStore) SaveBackfillBatch(_ context.Context, _ string, rows []store.InsertDelegation, r store.BackfillRange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.insert = append(m.insert, rows...)
+	m.backfillBatches = append(m.backfillBatches, len(rows))
+	for i := range m.ranges {
+		if m.ranges[i].FromLevel == r.FromLevel {
+			m.ranges[i] = r
+		}
+	}
+	return nil
 }
 
 type mockClient struct {
 	delegations []tzkt.Delegation
+	byLevel     map[int64][]tzkt.Delegation
+
+	since   *time.Time
+	afterID *int64
+	levels  []int64
 }
 
-func (m *mockClient) FetchDelegations(context.Context, time.Time, int) ([]tzkt.Delegation, error) {
+func (m *mockClient) FetchDelegations(_ context.Context, since time.Time, _ int) ([]tzkt.Delegation, error) {
+	m.since = &since
+	return m.delegations, nil
+}
+func (m *mockClient) FetchDelegationsAfterID(_ context.Context, afterID int64, _ int) ([]tzkt.Delegation, error) {
+	m.afterID = &afterID
 	return m.delegations, nil
 }
+func (m *mockClient) FetchDelegationsAtLevel(_ context.Context, level int64) ([]tzkt.Delegation, error) {
+	m.levels = append(m.levels, level)
+	return m.byLevel[level], nil
+}
+
+func (m *mockClient) FetchDelegationsInRange(context.Context, int64, int64, int64, int) ([]tzkt.Delegation, error) {
+	return m.delegations, nil
+}
+func (m *mockClient) StreamDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit, chunkSize int, handle func([]tzkt.Delegation) error) (int, error) {
+	return streamChunks(m.delegations, chunkSize, handle)
+}
+func (m *mockClient) FetchStakingAfterID(context.Context, int64, int64, int) ([]tzkt.StakingOperation, error) {
+	return nil, nil
+}
+func (m *mockClient) CountDelegationsInRange(context.Context, int64, int64) (int, error) {
+	return len(m.delegations), nil
+}
+func (m *mockClient) FetchBlocks(context.Context, int64, int) ([]tzkt.Block, error) {
+	return nil, nil
+}
+func (m *mockClient) FetchHead(context.Context) (tzkt.Block, error) {
+	return tzkt.Block{}, nil
+}
+
+// fakeChain is a tzkt.Client over an in-memory chain that can be reorganized.
+type fakeChain struct {
+	head   int64
+	branch string
+	hashes map[int64]string
+	ops    []tzkt.Delegation
+	nextID int64
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{branch: "a", hashes: make(map[int64]string), nextID: 1}
+}
+
+// bake appends a block with one delegation from delegator.
+func (c *fakeChain) bake(delegator string) {
+	c.head++
+	c.hashes[c.head] = fmt.Sprintf("B%d%s", c.head, c.branch)
+	d := tzkt.Delegation{
+		ID:        c.nextID,
+		Level:     c.head,
+		Block:     c.hashes[c.head],
+		Timestamp: time.Date(2024, 1, 1, 0, 0, int(c.head), 0, time.UTC),
+		Amount:    c.head,
+	}
+	d.Sender.Address = delegator
+	c.ops = append(c.ops, d)
+	c.nextID++
+}
+
+// reorg drops every block from level onwards and switches to a new branch,
+// reusing the operation ids of the dropped blocks as TzKT does.
+func (c *fakeChain) reorg(level int64, branch string) {
+	kept := c.ops[:0]
+	for _, d := range c.ops {
+		if d.Level < level {
+			kept = append(kept, d)
+		}
+	}
+	c.ops = kept
+	for lvl := level; lvl <= c.head; lvl++ {
+		delete(c.hashes, lvl)
+	}
+	c.head = level - 1
+	c.branch = branch
+	c.nextID = 1
+	if n := len(c.ops); n > 0 {
+		c.nextID = c.ops[n-1].ID + 1
+	}
+}
+
+func (c *fakeChain) FetchDelegations(_ context.Context, since time.Time, limit int) ([]tzkt.Delegation, error) {
+	var out []tzkt.Delegation
+	for _, d := range c.ops {
+		if d.Timestamp.After(since) && len(out) < limit {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+func (c *fakeChain) FetchDelegationsAfterID(_ context.Context, afterID int64, limit int) ([]tzkt.Delegation, error) {
+	var out []tzkt.Delegation
+	for _, d := range c.ops {
+		if d.ID > afterID && len(out) < limit {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+func (c *fakeChain) FetchDelegationsAtLevel(_ context.Context, level int64) ([]tzkt.Delegation, error) {
+	var out []tzkt.Delegation
+	for _, d := range c.ops {
+		if d.Level == level {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+func (c *fakeChain) FetchDelegationsInRange(_ context.Context, fromLevel, toLevel, afterID int64, limit int) ([]tzkt.Delegation, error) {
+	var out []tzkt.Delegation
+	for _, d := range c.ops {
+		if d.Level >= fromLevel && d.Level < toLevel && d.ID > afterID && len(out) < limit {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+func (c *fakeChain) StreamDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit, chunkSize int, handle func([]tzkt.Delegation) error) (int, error) {
+	delegations, _ := c.FetchDelegationsInRange(ctx, fromLevel, toLevel, afterID, limit)
+	return streamChunks(delegations, chunkSize, handle)
+}
+func (c *fakeChain) FetchStakingAfterID(context.Context, int64, int64, int) ([]tzkt.StakingOperation, error) {
+	return nil, nil
+}
+func (c *fakeChain) CountDelegationsInRange(ctx context.Context, fromLevel, toLevel int64) (int, error) {
+	delegations, _ := c.FetchDelegationsInRange(ctx, fromLevel, toLevel, 0, math.MaxInt)
+	return len(delegations), nil
+}
+func (c *fakeChain) FetchHead(context.Context) (tzkt.Block, error) {
+	return tzkt.Block{Level: c.head, Hash: c.hashes[c.head]}, nil
+}
+func (c *fakeChain) FetchBlocks(_ context.Context, fromLevel int64, limit int) ([]tzkt.Block, error) {
+	var out []tzkt.Block
+	for lvl := fromLevel; lvl <= c.head && len(out) < limit; lvl++ {
+		if lvl < 1 {
+			continue
+		}
+		out = append(out, tzkt.Block{Level: lvl, Hash: c.hashes[lvl]})
+	}
+	return out, nil
+}
+
+// streamChunks hands delegations to handle in chunks of at most size, as the
+// streaming TzKT client does.
+func streamChunks(delegations []tzkt.Delegation, size int, handle func([]tzkt.Delegation) error) (int, error) {
+	for start := 0; start < len(delegations); start += size {
+		end := min(start+size, len(delegations))
+		if err := handle(delegations[start:end]); err != nil {
+			return end, err
+		}
+	}
+	return len(delegations), nil
+}
 
 func TestSyncOnce_Inserts(t *testing.T) {
 	now := time.Now().UTC()
-	ms := &mockStore{lastTs: now.Add(-time.Hour)}
+	ms := &mockStore{}
 	mc := &mockClient{
 		delegations: []tzkt.Delegation{
 			{
@@ -65,3 +342,463 @@ func TestSyncOnce_Inserts(t *testing.T) {
 	require.Len(t, ms.insert, 1)
 	require.Equal(t, int64(1), ms.insert[0].TzktID)
 }
+
+func TestSyncOnce_MapsBakers(t *testing.T) {
+	now := time.Now().UTC()
+	ms := &mockStore{}
+	d := tzkt.Delegation{ID: 2, Level: 11, Timestamp: now, Amount: 500}
+	d.Sender.Address = "tz1abc"
+	d.PrevDelegate = &tzkt.Account{Address: "tz1old"}
+	d.NewDelegate = &tzkt.Account{Address: "tz1new", Alias: "New Baker"}
+	mc := &mockClient{delegations: []tzkt.Delegation{d}}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.insert, 1)
+	require.Equal(t, "tz1new", ms.insert[0].Baker)
+	require.Equal(t, "New Baker", ms.insert[0].BakerAlias)
+	require.Equal(t, "tz1old", ms.insert[0].PreviousBaker)
+	require.Empty(t, ms.insert[0].PreviousBakerAlias)
+}
+
+func TestSyncOnce_KeepsStatusAndErrors(t *testing.T) {
+	now := time.Now().UTC()
+	ms := &mockStore{}
+	applied := tzkt.Delegation{ID: 3, Level: 12, Timestamp: now, Status: "applied"}
+	applied.Sender.Address = "tz1abc"
+	failed := tzkt.Delegation{ID: 4, Level: 12, Timestamp: now, Status: "failed",
+		Errors: []tzkt.OperationError{{Type: "contract.manager.unregistered_delegate"}}}
+	failed.Sender.Address = "tz1def"
+	mc := &mockClient{delegations: []tzkt.Delegation{applied, failed}}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.insert, 2)
+	require.Equal(t, "applied", ms.insert[0].Status)
+	require.Empty(t, ms.insert[0].Errors)
+	require.Equal(t, "failed", ms.insert[1].Status)
+	require.Equal(t, []string{"contract.manager.unregistered_delegate"}, ms.insert[1].Errors)
+	require.Equal(t, int64(4), ms.state.CursorID)
+}
+
+func TestSyncOnce_StartsFromGenesis(t *testing.T) {
+	genesis := time.Date(2018, 6, 30, 0, 0, 0, 0, time.UTC)
+	ms := &mockStore{}
+	mc := &mockClient{}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100, GenesisStart: genesis})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, mc.since)
+	require.True(t, genesis.Equal(*mc.since))
+	require.Nil(t, mc.afterID)
+}
+
+func TestSyncOnce_PagesByID(t *testing.T) {
+	ms := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 42}}
+	mc := &mockClient{}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, mc.since)
+	require.NotNil(t, mc.afterID)
+	require.Equal(t, int64(42), *mc.afterID)
+}
+
+func TestSyncOnce_RepairsBoundaryBlocksOnce(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	skipped := tzkt.Delegation{ID: 7, Level: 500, Timestamp: ts, Amount: 1}
+	skipped.Sender.Address = "tz1skipped"
+
+	ms := &mockStore{
+		state:      store.SyncState{Name: syncStateName, CursorID: 100},
+		boundaries: []int64{500},
+	}
+	mc := &mockClient{byLevel: map[int64][]tzkt.Delegation{500: {skipped}}}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{500}, mc.levels)
+	require.Len(t, ms.insert, 1)
+	require.Equal(t, int64(7), ms.insert[0].TzktID)
+	require.True(t, ms.repairs[boundaryRepair])
+
+	// A restarted poller must not repeat the repair.
+	p = NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+	_, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{500}, mc.levels)
+}
+
+func TestSyncOnce_AdvancesCheckpoint(t *testing.T) {
+	ts := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := tzkt.Delegation{ID: 43, Level: 900, Timestamp: ts}
+	first.Sender.Address = "tz1first"
+	// A row without a sender is dropped but must still move the cursor.
+	last := tzkt.Delegation{ID: 44, Level: 901, Timestamp: ts.Add(time.Minute)}
+
+	ms := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 42, BatchCount: 3}}
+	mc := &mockClient{delegations: []tzkt.Delegation{first, last}}
+
+	p := NewPoller(Config{Store: ms, Client: mc, BatchSize: 100})
+
+	n, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Len(t, ms.insert, 1)
+	require.Equal(t, int64(44), ms.state.CursorID)
+	require.Equal(t, int64(901), ms.state.Level)
+	require.True(t, ts.Add(time.Minute).Equal(ms.state.Timestamp))
+	require.Equal(t, int64(4), ms.state.BatchCount)
+
+	state, err := p.SyncState(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ms.state, state)
+}
+
+func TestSyncOnce_RollsBackOnReorg(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 5; i++ {
+		chain.bake(fmt.Sprintf("tz1old%d", i))
+	}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{Store: ms, Client: chain, BatchSize: 100, ReorgWindow: 10})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.insert, 5)
+	_, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.blocks, 5)
+
+	// Levels 4 and 5 are replaced by a longer branch whose operations reuse their ids.
+	chain.reorg(4, "b")
+	chain.bake("tz1new4")
+	chain.bake("tz1new5")
+	chain.bake("tz1new6")
+
+	_, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.insert, 3, "delegations from the orphaned blocks are deleted")
+	require.Equal(t, int64(3), ms.state.CursorID)
+
+	for i := 0; i < 2; i++ {
+		_, err = p.syncOnce(context.Background())
+		require.NoError(t, err)
+	}
+
+	var delegators []string
+	for _, r := range ms.insert {
+		delegators = append(delegators, r.Delegator)
+	}
+	require.Equal(t, []string{"tz1old0", "tz1old1", "tz1old2", "tz1new4", "tz1new5", "tz1new6"}, delegators)
+	require.Equal(t, int64(6), ms.state.CursorID)
+	require.Equal(t, "B5b", ms.blocks[5].Hash)
+}
+
+func TestSyncOnce_RejectsBatchFromOrphanedBlock(t *testing.T) {
+	chain := newFakeChain()
+	chain.bake("tz1a")
+	stale := chain.ops[0]
+	stale.Block = "B1orphan"
+	mc := &mockClient{delegations: []tzkt.Delegation{stale}}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{Store: ms, Client: &blocksFrom{mockClient: mc, chain: chain}, BatchSize: 100, ReorgWindow: 10})
+
+	_, err := p.syncOnce(context.Background())
+	require.ErrorContains(t, err, "changed during sync")
+	require.Empty(t, ms.insert)
+}
+
+func TestSyncOnce_ShortBlockWindowDoesNotRollBack(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 5; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	ms := &mockStore{}
+	client := &shortBlocks{fakeChain: chain}
+	p := NewPoller(Config{Store: ms, Client: client, BatchSize: 100, ReorgWindow: 10})
+
+	_, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.blocks, 5)
+
+	// An instance two levels behind returns a window that stops short of head.
+	client.missing = 2
+	_, err = p.syncOnce(context.Background())
+	require.ErrorContains(t, err, "blocks end at level 3, before head 5")
+	require.Len(t, ms.insert, 5, "nothing is rolled back")
+	require.Equal(t, int64(5), ms.state.CursorID)
+
+	client.missing = 0
+	_, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.insert, 5)
+}
+
+// shortBlocks is a fakeChain whose blocks lag its delegations by missing levels.
+type shortBlocks struct {
+	*fakeChain
+	missing int
+}
+
+func (s *shortBlocks) FetchBlocks(ctx context.Context, fromLevel int64, limit int) ([]tzkt.Block, error) {
+	blocks, err := s.fakeChain.FetchBlocks(ctx, fromLevel, limit)
+	return blocks[:max(len(blocks)-s.missing, 0)], err
+}
+
+// blocksFrom serves delegations from a mockClient and blocks from a fakeChain.
+type blocksFrom struct {
+	*mockClient
+	chain *fakeChain
+}
+
+func (b *blocksFrom) FetchBlocks(ctx context.Context, fromLevel int64, limit int) ([]tzkt.Block, error) {
+	return b.chain.FetchBlocks(ctx, fromLevel, limit)
+}
+
+func TestBackfill_SyncsRangesAndHandsOff(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 25; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{
+		Store:              ms,
+		Client:             chain,
+		BatchSize:          2,
+		ReorgWindow:        5,
+		BackfillWorkers:    3,
+		BackfillRangeSize:  4,
+		BackfillStartLevel: 1,
+	})
+
+	require.NoError(t, p.backfill(context.Background()))
+	require.Len(t, ms.ranges, 5, "levels 1-20 in ranges of 4 levels")
+	for _, r := range ms.ranges {
+		require.True(t, r.Done)
+	}
+	require.Len(t, ms.insert, 20)
+	require.Equal(t, int64(20), ms.state.CursorID)
+	require.Equal(t, int64(20), ms.state.Level)
+	require.True(t, ms.repairs[boundaryRepair])
+
+	// The live poller picks up the levels left to the reorg window.
+	for i := 0; i < 3; i++ {
+		_, err := p.syncOnce(context.Background())
+		require.NoError(t, err)
+	}
+	require.Len(t, ms.insert, 25)
+	require.Equal(t, int64(25), ms.state.CursorID)
+}
+
+func TestBackfill_StartsAtGenesis(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 20; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{
+		Store:             ms,
+		Client:            chain,
+		BatchSize:         100,
+		GenesisStart:      time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC),
+		BackfillWorkers:   2,
+		BackfillRangeSize: 5,
+	})
+
+	require.NoError(t, p.backfill(context.Background()))
+	require.Equal(t, int64(11), ms.ranges[0].FromLevel, "the first delegation after genesis")
+	require.Len(t, ms.insert, 10)
+	for _, d := range ms.insert {
+		require.Greater(t, d.TzktID, int64(10))
+	}
+	require.Equal(t, int64(20), ms.state.CursorID)
+}
+
+func TestBackfill_ResumesFromRangeCheckpoints(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 20; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+
+	ms := &mockStore{ranges: []store.BackfillRange{
+		{FromLevel: 1, ToLevel: 11, CursorID: 10, Done: true},
+		{FromLevel: 11, ToLevel: 21, CursorID: 15},
+	}}
+	p := NewPoller(Config{Store: ms, Client: chain, BatchSize: 100, BackfillWorkers: 2})
+
+	require.NoError(t, p.backfill(context.Background()))
+	require.Len(t, ms.insert, 5)
+	require.Equal(t, int64(16), ms.insert[0].TzktID)
+	require.Equal(t, int64(20), ms.state.CursorID)
+}
+
+func TestBackfill_SavesStreamedChunks(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 12; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{
+		Store:              ms,
+		Client:             chain,
+		BatchSize:          10,
+		ChunkSize:          4,
+		BackfillWorkers:    1,
+		BackfillRangeSize:  100,
+		BackfillStartLevel: 1,
+	})
+
+	require.NoError(t, p.backfill(context.Background()))
+	require.Len(t, ms.insert, 12)
+	// A full page of 10 in chunks of 4, then the last 2 and the range marked done.
+	require.Equal(t, []int{4, 4, 2, 2, 0}, ms.backfillBatches)
+	require.True(t, ms.ranges[0].Done)
+	require.Equal(t, int64(12), ms.ranges[0].CursorID)
+}
+
+func TestBackfill_StopsOnChunkFailure(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 10; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+
+	ms := &failingBackfillStore{mockStore: &mockStore{ranges: []store.BackfillRange{{FromLevel: 1, ToLevel: 11}}}, failAfter: 1}
+	p := NewPoller(Config{Store: ms, Client: chain, BatchSize: 10, ChunkSize: 3})
+
+	err := p.backfillRange(context.Background(), ms.ranges[0])
+	require.Error(t, err)
+	// The first chunk is checkpointed, so a retry resumes after it.
+	require.Len(t, ms.insert, 3)
+	require.Equal(t, int64(3), ms.ranges[0].CursorID)
+	require.False(t, ms.ranges[0].Done)
+}
+
+// failingBackfillStore fails every backfill batch after the first failAfter.
+type failingBackfillStore struct {
+	*mockStore
+	failAfter int
+}
+
+func (s *failingBackfillStore) SaveBackfillBatch(ctx context.Context, name string, rows []store.InsertDelegation, r store.BackfillRange) error {
+	if len(s.backfillBatches) >= s.failAfter {
+		return errors.New("database unavailable")
+	}
+	return s.mockStore.SaveBackfillBatch(ctx, name, rows, r)
+}
+
+func TestPlanRanges(t *testing.T) {
+	require.Equal(t, []store.BackfillRange{
+		{FromLevel: 0, ToLevel: 4},
+		{FromLevel: 4, ToLevel: 8},
+		{FromLevel: 8, ToLevel: 10},
+	}, planRanges(0, 10, 4))
+	require.Empty(t, planRanges(10, 10, 4))
+}
+
+// fakeSubscriber replays scripted sessions, each ending with a disconnect.
+// Events are built lazily so that a session can change the chain first.
+type fakeSubscriber struct {
+	sessions [][]func() tzkt.Event
+	calls    int
+	// exhausted is called once every session has been replayed.
+	exhausted func()
+}
+
+func (f *fakeSubscriber) Subscribe(ctx context.Context, handle func(tzkt.Event) error) error {
+	if f.calls == len(f.sessions) {
+		f.exhausted()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	session := f.sessions[f.calls]
+	f.calls++
+	for _, next := range session {
+		if err := handle(next()); err != nil {
+			return err
+		}
+	}
+	return errors.New("disconnected")
+}
+
+func TestRun_StreamsAndFillsGapsOnReconnect(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 3; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	state := func() tzkt.Event { return tzkt.Event{Type: tzkt.EventState, State: chain.head} }
+	// bakeAndPush adds a block and returns the data event announcing it.
+	bakeAndPush := func() tzkt.Event {
+		chain.bake(fmt.Sprintf("tz1d%d", chain.head))
+		return tzkt.Event{Type: tzkt.EventData, State: chain.head, Delegations: chain.ops[len(chain.ops)-1:]}
+	}
+	// bakeWhileDisconnected adds blocks that are never pushed.
+	bakeWhileDisconnected := func() tzkt.Event {
+		chain.bake(fmt.Sprintf("tz1d%d", chain.head))
+		chain.bake(fmt.Sprintf("tz1d%d", chain.head))
+		return tzkt.Event{Type: -1}
+	}
+	replay := func() tzkt.Event {
+		return tzkt.Event{Type: tzkt.EventData, State: chain.head, Delegations: chain.ops[len(chain.ops)-1:]}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := &fakeSubscriber{
+		sessions: [][]func() tzkt.Event{
+			{state, bakeAndPush, bakeWhileDisconnected},
+			{state, replay, bakeAndPush},
+		},
+		exhausted: cancel,
+	}
+
+	ms := &mockStore{}
+	p := NewPoller(Config{
+		Store:               ms,
+		Client:              chain,
+		BatchSize:           2,
+		PollInterval:        time.Hour,
+		Subscriber:          sub,
+		StreamRetryInterval: time.Millisecond,
+	})
+	require.NoError(t, p.Run(ctx))
+
+	require.Equal(t, 2, sub.calls)
+	var ids []int64
+	for _, r := range ms.insert {
+		ids = append(ids, r.TzktID)
+	}
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7}, ids)
+	require.Equal(t, int64(7), ms.state.CursorID)
+}
+
+func TestHandleEvent_ReorgRollsBack(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 4; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	ms := &mockStore{}
+	p := NewPoller(Config{Store: ms, Client: chain, BatchSize: 100})
+
+	require.NoError(t, p.handleEvent(context.Background(), tzkt.Event{Type: tzkt.EventState, State: 4}))
+	require.Len(t, ms.insert, 4)
+
+	require.NoError(t, p.handleEvent(context.Background(), tzkt.Event{Type: tzkt.EventReorg, State: 2}))
+	require.Len(t, ms.insert, 2)
+	require.Equal(t, int64(2), ms.state.CursorID)
+}
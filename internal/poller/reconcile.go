@@ -0,0 +1,261 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+type ReconcileConfig struct {
+	// Store receives the repaired delegations and holds the sync checkpoint.
+	Store store.DelegationStore
+	// Audit counts stored delegations and logs every reconciliation.
+	Audit  store.AuditStore
+	Client tzkt.Client
+	// BatchSize is the page size of the delegations listed from TzKT.
+	BatchSize int
+	// RangeSize is the number of levels compared by a single count.
+	RangeSize int64
+	// LeafSize is the number of delegations below which a mismatching range
+	// is listed and diffed rather than bisected further.
+	LeafSize int
+	// Interval is the time between two reconciliations of the table.
+	Interval time.Duration
+	// Confirmations leaves the levels closer than this to the synced head to
+	// the live poller and its reorganization checks.
+	Confirmations int
+	// GenesisStart, when set, starts the reconciliation at the level of the
+	// first delegation after it rather than at level 1.
+	GenesisStart time.Time
+	Logger       *log.Logger
+}
+
+// Reconciler checks that the delegations table is complete: it compares the
+// number of stored delegations per level range with TzKT's count, bisects the
+// ranges that differ down to the missing delegations and inserts them.
+type Reconciler struct {
+	cfg ReconcileConfig
+	// start is the first level reconciled, once known.
+	start int64
+}
+
+func NewReconciler(cfg ReconcileConfig) *Reconciler {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10000
+	}
+	if cfg.RangeSize <= 0 {
+		cfg.RangeSize = 100000
+	}
+	if cfg.LeafSize <= 0 {
+		cfg.LeafSize = 1000
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	return &Reconciler{cfg: cfg}
+}
+
+// Run reconciles the table every Interval until ctx is done. It returns early
+// if the client cannot count delegations.
+func (r *Reconciler) Run(ctx context.Context) error {
+	for {
+		results, err := r.RunOnce(ctx)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			r.cfg.Logger.Printf("reconciler stopped: %v", err)
+			return nil
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil
+			}
+			r.cfg.Logger.Printf("reconciler error: %v", err)
+		default:
+			repaired := 0
+			for _, res := range results {
+				repaired += len(res.RepairedIDs)
+			}
+			r.cfg.Logger.Printf("reconciler: checked %d ranges, repaired %d delegations", len(results), repaired)
+		}
+
+		select {
+		case <-time.After(r.cfg.Interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// RunOnce reconciles every range from the first delegation up to the
+// confirmed part of the synced history, and logs each of them. It does nothing until the
+// live poller has taken over from the backfill, which would otherwise be
+// repaired range by range. A range that fails is logged with its error and the
+// next one is reconciled.
+func (r *Reconciler) RunOnce(ctx context.Context) ([]store.Reconciliation, error) {
+	state, err := r.cfg.Store.GetSyncState(ctx, syncStateName)
+	if err != nil {
+		return nil, fmt.Errorf("get sync state: %w", err)
+	}
+	if state.CursorID == 0 {
+		return nil, nil
+	}
+	end := state.Level - int64(r.cfg.Confirmations) + 1
+	start, err := r.startLevel(ctx)
+	if err != nil || start == 0 {
+		return nil, err
+	}
+
+	runAt := time.Now().UTC()
+	var results []store.Reconciliation
+	for from := start; from < end; from += r.cfg.RangeSize {
+		res := store.Reconciliation{RunAt: runAt, FromLevel: from, ToLevel: min(from+r.cfg.RangeSize, end)}
+		if err := r.reconcile(ctx, &res); err != nil {
+			if ctx.Err() != nil || errors.Is(err, errors.ErrUnsupported) {
+				return results, err
+			}
+			res.Error = err.Error()
+			r.cfg.Logger.Printf("reconciler: levels [%d, %d): %v", res.FromLevel, res.ToLevel, err)
+		}
+		if err := r.cfg.Audit.SaveReconciliation(ctx, res); err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// startLevel returns the first level to reconcile: 1 without GenesisStart,
+// otherwise the level of the first delegation after it, or 0 while there is
+// none.
+func (r *Reconciler) startLevel(ctx context.Context) (int64, error) {
+	if r.start > 0 {
+		return r.start, nil
+	}
+	if r.cfg.GenesisStart.IsZero() {
+		r.start = 1
+		return r.start, nil
+	}
+	level, err := firstLevel(ctx, r.cfg.Client, r.cfg.GenesisStart)
+	if err != nil {
+		return 0, err
+	}
+	r.start = level
+	return r.start, nil
+}
+
+// reconcile compares the range of res and inserts what is missing from it.
+func (r *Reconciler) reconcile(ctx context.Context, res *store.Reconciliation) error {
+	stored, source, err := r.counts(ctx, res.FromLevel, res.ToLevel)
+	if err != nil {
+		return err
+	}
+	res.StoredCount, res.SourceCount = stored, source
+	if stored == source {
+		return nil
+	}
+
+	missing, err := r.missing(ctx, res.FromLevel, res.ToLevel, source)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		r.cfg.Logger.Printf("reconciler: levels [%d, %d) hold %d delegations unknown to TzKT", res.FromLevel, res.ToLevel, stored-source)
+		return nil
+	}
+	// Delegations without a sender are never stored, by the poller either, so
+	// they are reported rather than counted as repaired.
+	batch := toInsertBatch(missing)
+	if dropped := len(missing) - len(batch); dropped > 0 {
+		r.cfg.Logger.Printf("reconciler: levels [%d, %d) hold %d delegations without a sender, not stored", res.FromLevel, res.ToLevel, dropped)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := r.cfg.Store.BulkInsert(ctx, batch); err != nil {
+		return fmt.Errorf("insert %d missing delegations: %w", len(batch), err)
+	}
+	for _, d := range batch {
+		res.RepairedIDs = append(res.RepairedIDs, d.TzktID)
+	}
+	r.cfg.Logger.Printf("reconciler: repaired %d delegations in levels [%d, %d)", len(batch), res.FromLevel, res.ToLevel)
+	return nil
+}
+
+func (r *Reconciler) counts(ctx context.Context, from, to int64) (int, int, error) {
+	stored, err := r.cfg.Audit.CountInRange(ctx, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	source, err := r.cfg.Client.CountDelegationsInRange(ctx, from, to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("count delegations in [%d, %d): %w", from, to, err)
+	}
+	return stored, source, nil
+}
+
+// missing returns the delegations of TzKT in [from, to) that are not stored.
+// Ranges with more than LeafSize delegations at the source are split in two,
+// and only the halves whose counts differ are searched.
+func (r *Reconciler) missing(ctx context.Context, from, to int64, source int) ([]tzkt.Delegation, error) {
+	if source <= r.cfg.LeafSize || to-from <= 1 {
+		return r.diff(ctx, from, to)
+	}
+
+	mid := from + (to-from)/2
+	var out []tzkt.Delegation
+	for _, half := range [][2]int64{{from, mid}, {mid, to}} {
+		stored, source, err := r.counts(ctx, half[0], half[1])
+		if err != nil {
+			return nil, err
+		}
+		if stored == source {
+			continue
+		}
+		found, err := r.missing(ctx, half[0], half[1], source)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, found...)
+	}
+	return out, nil
+}
+
+// diff lists the delegations of TzKT in [from, to) and returns those whose
+// id is not stored.
+func (r *Reconciler) diff(ctx context.Context, from, to int64) ([]tzkt.Delegation, error) {
+	stored, err := r.cfg.Audit.GetDelegationsInRange(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool, len(stored))
+	for _, d := range stored {
+		ids[d.TzktID] = true
+	}
+
+	var (
+		out     []tzkt.Delegation
+		afterID int64
+	)
+	for {
+		page, err := r.cfg.Client.FetchDelegationsInRange(ctx, from, to, afterID, r.cfg.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("fetch delegations in [%d, %d): %w", from, to, err)
+		}
+		for _, d := range page {
+			if !ids[d.ID] {
+				out = append(out, d)
+			}
+		}
+		if len(page) < r.cfg.BatchSize {
+			return out, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+}
@@ -0,0 +1,189 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+)
+
+// mockAudit audits the rows of a mockStore.
+type mockAudit struct {
+	store *mockStore
+	saved []store.Reconciliation
+}
+
+func (a *mockAudit) rows(from, to int64) []store.StoredDelegation {
+	var out []store.StoredDelegation
+	for _, r := range a.store.insert {
+		if r.Level >= from && r.Level < to {
+			out = append(out, store.StoredDelegation{TzktID: r.TzktID, Level: r.Level, Delegator: r.Delegator, Amount: r.Amount, Status: r.Status})
+		}
+	}
+	return out
+}
+func (a *mockAudit) LevelBounds(context.Context) (int64, int64, error) {
+	return 0, 0, errors.New("not used")
+}
+func (a *mockAudit) GetDelegationsInRange(_ context.Context, from, to int64) ([]store.StoredDelegation, error) {
+	return a.rows(from, to), nil
+}
+func (a *mockAudit) CountInRange(_ context.Context, from, to int64) (int, error) {
+	return len(a.rows(from, to)), nil
+}
+func (a *mockAudit) SaveReconciliation(_ context.Context, r store.Reconciliation) error {
+	a.saved = append(a.saved, r)
+	return nil
+}
+
+func TestReconciler_RepairsMissingDelegations(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 50; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	st := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 50, Level: 50}}
+	for _, d := range toInsertBatch(chain.ops) {
+		if d.TzktID != 7 && d.TzktID != 23 && d.TzktID != 24 && d.TzktID != 50 {
+			st.insert = append(st.insert, d)
+		}
+	}
+	audit := &mockAudit{store: st}
+
+	r := NewReconciler(ReconcileConfig{
+		Store:         st,
+		Audit:         audit,
+		Client:        chain,
+		RangeSize:     20,
+		LeafSize:      2,
+		Confirmations: 1,
+		Logger:        log.New(io.Discard, "", 0),
+	})
+	results, err := r.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, results, audit.saved)
+	require.Len(t, results, 3)
+
+	require.Equal(t, [2]int64{1, 21}, [2]int64{results[0].FromLevel, results[0].ToLevel})
+	require.Equal(t, 19, results[0].StoredCount)
+	require.Equal(t, 20, results[0].SourceCount)
+	require.Equal(t, []int64{7}, results[0].RepairedIDs)
+	require.Equal(t, []int64{23, 24}, results[1].RepairedIDs)
+	require.Equal(t, [2]int64{41, 50}, [2]int64{results[2].FromLevel, results[2].ToLevel}, "unconfirmed levels are left out")
+	require.Empty(t, results[2].RepairedIDs)
+	require.Empty(t, results[2].Error)
+
+	require.Len(t, st.insert, 49, "every confirmed delegation is stored")
+	results, err = r.RunOnce(context.Background())
+	require.NoError(t, err)
+	for _, res := range results {
+		require.Equal(t, res.StoredCount, res.SourceCount)
+		require.Empty(t, res.RepairedIDs)
+	}
+}
+
+func TestReconciler_StartsAtGenesis(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 30; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	st := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 30, Level: 30}}
+	st.insert = toInsertBatch(chain.ops)
+	r := NewReconciler(ReconcileConfig{
+		Store:        st,
+		Audit:        &mockAudit{store: st},
+		Client:       chain,
+		RangeSize:    10,
+		GenesisStart: time.Date(2024, 1, 1, 0, 0, 14, 0, time.UTC),
+		Logger:       log.New(io.Discard, "", 0),
+	})
+
+	results, err := r.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, [2]int64{15, 25}, [2]int64{results[0].FromLevel, results[0].ToLevel}, "the first delegation after genesis")
+	require.Equal(t, [2]int64{25, 31}, [2]int64{results[1].FromLevel, results[1].ToLevel})
+}
+
+func TestReconciler_DoesNotRepairSenderlessDelegations(t *testing.T) {
+	chain := newFakeChain()
+	for i := 0; i < 10; i++ {
+		chain.bake(fmt.Sprintf("tz1d%d", i))
+	}
+	chain.ops[3].Sender.Address = ""
+	st := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 10, Level: 10}}
+	for _, d := range toInsertBatch(chain.ops) {
+		if d.TzktID != 6 {
+			st.insert = append(st.insert, d)
+		}
+	}
+	r := NewReconciler(ReconcileConfig{
+		Store:     st,
+		Audit:     &mockAudit{store: st},
+		Client:    chain,
+		RangeSize: 100,
+		Logger:    log.New(io.Discard, "", 0),
+	})
+
+	results, err := r.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, []int64{6}, results[0].RepairedIDs, "the delegation without a sender is not stored")
+	require.Len(t, st.insert, 9)
+}
+
+func TestReconciler_WaitsForTheBackfill(t *testing.T) {
+	st := &mockStore{}
+	audit := &mockAudit{store: st}
+	r := NewReconciler(ReconcileConfig{Store: st, Audit: audit, Client: newFakeChain()})
+
+	results, err := r.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, results)
+	require.Empty(t, audit.saved)
+}
+
+type countFailingChain struct {
+	*fakeChain
+	err error
+}
+
+func (c countFailingChain) CountDelegationsInRange(context.Context, int64, int64) (int, error) {
+	return 0, c.err
+}
+
+func TestReconciler_LogsFailedRanges(t *testing.T) {
+	st := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 10, Level: 10}}
+	audit := &mockAudit{store: st}
+	r := NewReconciler(ReconcileConfig{
+		Store:     st,
+		Audit:     audit,
+		Client:    countFailingChain{newFakeChain(), errors.New("tzkt down")},
+		RangeSize: 5,
+		Logger:    log.New(io.Discard, "", 0),
+	})
+
+	results, err := r.RunOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, audit.saved, 2)
+	for _, res := range results {
+		require.Contains(t, res.Error, "tzkt down")
+	}
+}
+
+func TestReconciler_StopsWhenUnsupported(t *testing.T) {
+	st := &mockStore{state: store.SyncState{Name: syncStateName, CursorID: 10, Level: 10}}
+	r := NewReconciler(ReconcileConfig{
+		Store:  st,
+		Audit:  &mockAudit{store: st},
+		Client: countFailingChain{newFakeChain(), fmt.Errorf("node: %w", errors.ErrUnsupported)},
+		Logger: log.New(io.Discard, "", 0),
+	})
+	require.NoError(t, r.Run(context.Background()))
+}
@@ -0,0 +1,135 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// stakingStateName is the checkpoint the staking poller reads and advances in sync_state.
+const stakingStateName = "staking"
+
+type StakingConfig struct {
+	Store        store.StakingStore
+	Client       tzkt.Client
+	BatchSize    int
+	PollInterval time.Duration
+	MaxBackoff   time.Duration
+	// Confirmations is how many levels below the head an operation must be
+	// before it is stored. Staking operations are not rolled back, so they
+	// are only ingested once a reorganization can no longer remove them.
+	Confirmations int
+	Logger        *log.Logger
+}
+
+// StakingPoller ingests stake, unstake and finalize operations with its own
+// checkpoint, independently of the delegation poller.
+type StakingPoller struct {
+	cfg StakingConfig
+}
+
+func NewStakingPoller(cfg StakingConfig) *StakingPoller {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10000
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 15 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 2 * time.Minute
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	return &StakingPoller{cfg: cfg}
+}
+
+// Run syncs staking operations until ctx is done, backing off on errors. It
+// returns early if the client cannot fetch staking operations.
+func (p *StakingPoller) Run(ctx context.Context) error {
+	backoff := p.cfg.PollInterval
+
+	for {
+		n, err := p.syncOnce(ctx)
+		var wait time.Duration
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			p.cfg.Logger.Printf("staking poller stopped: %v", err)
+			return nil
+		case err != nil:
+			p.cfg.Logger.Printf("staking poller error: %v", err)
+			wait = backoff
+			backoff = min(backoff*2, p.cfg.MaxBackoff)
+		case n == p.cfg.BatchSize:
+			backoff = p.cfg.PollInterval
+			continue
+		default:
+			backoff = p.cfg.PollInterval
+			wait = p.cfg.PollInterval
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// syncOnce stores the next batch of confirmed staking operations and returns
+// how many were fetched.
+func (p *StakingPoller) syncOnce(ctx context.Context) (int, error) {
+	state, err := p.cfg.Store.GetSyncState(ctx, stakingStateName)
+	if err != nil {
+		return 0, fmt.Errorf("get staking sync state: %w", err)
+	}
+
+	head, err := p.cfg.Client.FetchHead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("fetch head: %w", err)
+	}
+	maxLevel := head.Level - int64(p.cfg.Confirmations)
+
+	ops, err := p.cfg.Client.FetchStakingAfterID(ctx, state.CursorID, maxLevel, p.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("fetch staking operations after id %d: %w", state.CursorID, err)
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	last := ops[len(ops)-1]
+	next := store.SyncState{
+		Name:      stakingStateName,
+		CursorID:  last.ID,
+		Level:     last.Level,
+		Timestamp: last.Timestamp,
+	}
+	rows := make([]store.InsertStakingOperation, 0, len(ops))
+	for _, op := range ops {
+		row := store.InsertStakingOperation{
+			TzktID:    op.ID,
+			Timestamp: op.Timestamp,
+			Level:     op.Level,
+			Staker:    op.Sender.Address,
+			Action:    op.Action,
+			Amount:    op.Amount,
+		}
+		if op.Baker != nil {
+			row.Baker = op.Baker.Address
+			row.BakerAlias = op.Baker.Alias
+		}
+		rows = append(rows, row)
+	}
+	if err := p.cfg.Store.SaveStakingBatch(ctx, rows, next); err != nil {
+		return 0, fmt.Errorf("save batch of %d staking operations: %w", len(rows), err)
+	}
+
+	p.cfg.Logger.Printf("staking poller: inserted %d operations after id %d", len(rows), state.CursorID)
+	return len(ops), nil
+}
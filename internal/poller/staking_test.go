@@ -0,0 +1,125 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+type mockStakingStore struct {
+	state store.SyncState
+	rows  []store.InsertStakingOperation
+}
+
+func (m *mockStakingStore) SaveStakingBatch(_ context.Context, rows []store.InsertStakingOperation, state store.SyncState) error {
+	m.rows = append(m.rows, rows...)
+	m.state = state
+	return nil
+}
+func (m *mockStakingStore) GetSyncState(_ context.Context, name string) (store.SyncState, error) {
+	if m.state.Name != name {
+		return store.SyncState{Name: name}, nil
+	}
+	return m.state, nil
+}
+func (m *mockStakingStore) GetStakingPage(context.Context, *int, int, int) ([]store.StakingOperation, error) {
+	return nil, nil
+}
+
+// stakingChain is a tzkt.Client serving staking operations one per level.
+type stakingChain struct {
+	mockClient
+	head int64
+	ops  []tzkt.StakingOperation
+	err  error
+}
+
+func (c *stakingChain) FetchHead(context.Context) (tzkt.Block, error) {
+	return tzkt.Block{Level: c.head}, nil
+}
+func (c *stakingChain) FetchStakingAfterID(_ context.Context, afterID, maxLevel int64, limit int) ([]tzkt.StakingOperation, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	var out []tzkt.StakingOperation
+	for _, op := range c.ops {
+		if op.ID > afterID && op.Level <= maxLevel && len(out) < limit {
+			out = append(out, op)
+		}
+	}
+	return out, nil
+}
+
+func newStakingChain(n int) *stakingChain {
+	c := &stakingChain{head: int64(n)}
+	actions := []string{tzkt.StakingStake, tzkt.StakingUnstake, tzkt.StakingFinalize}
+	for i := 1; i <= n; i++ {
+		op := tzkt.StakingOperation{
+			ID:        int64(i * 10),
+			Level:     int64(i),
+			Timestamp: time.Date(2024, 6, 1, 0, 0, i, 0, time.UTC),
+			Baker:     &tzkt.Account{Address: "tz1baker", Alias: "Baker"},
+			Action:    actions[i%len(actions)],
+			Amount:    int64(i) * 1_000_000,
+		}
+		op.Sender.Address = fmt.Sprintf("tz1staker%d", i)
+		c.ops = append(c.ops, op)
+	}
+	return c
+}
+
+func TestStakingPoller_SyncsConfirmedOperations(t *testing.T) {
+	chain := newStakingChain(10)
+	ms := &mockStakingStore{}
+	p := NewStakingPoller(StakingConfig{Store: ms, Client: chain, BatchSize: 4, Confirmations: 3})
+
+	n, err := p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, int64(40), ms.state.CursorID)
+	require.Equal(t, stakingStateName, ms.state.Name)
+
+	first := ms.rows[0]
+	require.Equal(t, int64(10), first.TzktID)
+	require.Equal(t, "tz1staker1", first.Staker)
+	require.Equal(t, "tz1baker", first.Baker)
+	require.Equal(t, "Baker", first.BakerAlias)
+	require.Equal(t, tzkt.StakingUnstake, first.Action)
+	require.Equal(t, int64(1_000_000), first.Amount)
+
+	// Operations less than Confirmations levels deep wait for the next cycles.
+	n, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Len(t, ms.rows, 7)
+
+	n, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	chain.head = 13
+	_, err = p.syncOnce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ms.rows, 10)
+	require.Equal(t, int64(100), ms.state.CursorID)
+}
+
+func TestStakingPoller_StopsWhenUnsupported(t *testing.T) {
+	chain := &stakingChain{err: fmt.Errorf("node: staking operations: %w", errors.ErrUnsupported)}
+	p := NewStakingPoller(StakingConfig{Store: &mockStakingStore{}, Client: chain})
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("staking poller kept running with an unsupported client")
+	}
+}
@@ -0,0 +1,87 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// stream ingests delegations pushed by the TzKT events hub until ctx is done.
+// Whenever the stream drops, it falls back to polling for StreamRetryInterval
+// before reconnecting. Every new subscription first catches up from the
+// checkpoint, which fills any gap left while disconnected.
+func (p *Poller) stream(ctx context.Context) {
+	for {
+		err := p.cfg.Subscriber.Subscribe(ctx, func(ev tzkt.Event) error {
+			return p.handleEvent(ctx, ev)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		p.cfg.Logger.Printf("poller: event stream disconnected: %v, polling for %s", err, p.cfg.StreamRetryInterval)
+
+		pollCtx, cancel := context.WithTimeout(ctx, p.cfg.StreamRetryInterval)
+		p.poll(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (p *Poller) handleEvent(ctx context.Context, ev tzkt.Event) error {
+	switch ev.Type {
+	case tzkt.EventState:
+		// Sent right after subscribing: anything newer arrives as data, so
+		// polling up to the current head closes the gap.
+		return p.catchUp(ctx)
+	case tzkt.EventData:
+		return p.ingest(ctx, ev.Delegations)
+	case tzkt.EventReorg:
+		state, err := p.cfg.Store.Rollback(ctx, syncStateName, ev.State+1)
+		if err != nil {
+			return fmt.Errorf("rollback from level %d: %w", ev.State+1, err)
+		}
+		p.cfg.Logger.Printf("poller: chain reorganization back to level %d, resyncing after id %d", ev.State, state.CursorID)
+	}
+	return nil
+}
+
+// catchUp runs sync cycles until TzKT returns a partial batch.
+func (p *Poller) catchUp(ctx context.Context) error {
+	for {
+		n, err := p.syncOnce(ctx)
+		if err != nil {
+			return fmt.Errorf("catch up: %w", err)
+		}
+		if n < p.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+// ingest stores streamed delegations that are newer than the checkpoint.
+func (p *Poller) ingest(ctx context.Context, delegations []tzkt.Delegation) error {
+	state, err := p.cfg.Store.GetSyncState(ctx, syncStateName)
+	if err != nil {
+		return fmt.Errorf("get sync state: %w", err)
+	}
+
+	fresh := make([]tzkt.Delegation, 0, len(delegations))
+	for _, d := range delegations {
+		if d.ID > state.CursorID {
+			fresh = append(fresh, d)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	inserted, err := p.save(ctx, fresh)
+	if err != nil {
+		return err
+	}
+	p.cfg.Logger.Printf("poller: streamed %d delegations after id %d", inserted, state.CursorID)
+	return nil
+}
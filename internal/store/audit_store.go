@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StoredDelegation is a delegation as stored, identified by its TzKT id, for
+// comparing the table with an upstream source.
+type StoredDelegation struct {
+	TzktID    int64
+	Level     int64
+	Delegator string
+	Amount    int64
+	Status    string
+}
+
+// Reconciliation is the outcome of comparing a level range [FromLevel,
+// ToLevel) of the delegations table with TzKT.
+type Reconciliation struct {
+	RunAt       time.Time
+	FromLevel   int64
+	ToLevel     int64
+	StoredCount int
+	SourceCount int
+	// RepairedIDs are the TzKT ids of the missing delegations that were inserted.
+	RepairedIDs []int64
+	// Error explains why the range could not be reconciled, if it failed.
+	Error string
+}
+
+// AuditStore reads the delegations of a network by level, to check them
+// against the chain, and logs the reconciliations of the table.
+type AuditStore interface {
+	// LevelBounds returns the lowest and highest levels holding a delegation,
+	// both 0 when there is none.
+	LevelBounds(ctx context.Context) (int64, int64, error)
+	// GetDelegationsInRange returns the delegations with a level in
+	// [fromLevel, toLevel), ordered by id.
+	GetDelegationsInRange(ctx context.Context, fromLevel, toLevel int64) ([]StoredDelegation, error)
+	// CountInRange returns the number of delegations with a level in [fromLevel, toLevel).
+	CountInRange(ctx context.Context, fromLevel, toLevel int64) (int, error)
+	SaveReconciliation(ctx context.Context, r Reconciliation) error
+}
+
+type auditStore struct {
+	db      *sql.DB
+	network string
+}
+
+// NewAuditStore returns an AuditStore scoped to a single network.
+func NewAuditStore(db *sql.DB, network string) AuditStore {
+	return &auditStore{db: db, network: network}
+}
+
+func (s *auditStore) LevelBounds(ctx context.Context) (int64, int64, error) {
+	var from, to int64
+	err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(MIN(level), 0), COALESCE(MAX(level), 0)
+FROM delegations
+WHERE network = $1
+`, s.network).Scan(&from, &to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query level bounds: %w", err)
+	}
+	return from, to, nil
+}
+
+func (s *auditStore) GetDelegationsInRange(ctx context.Context, fromLevel, toLevel int64) ([]StoredDelegation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT tzkt_id, level, delegator, amount, status
+FROM delegations
+WHERE network = $1 AND level >= $2 AND level < $3
+ORDER BY tzkt_id
+`, s.network, fromLevel, toLevel)
+	if err != nil {
+		return nil, fmt.Errorf("query delegations in range: %w", err)
+	}
+	defer rows.Close()
+
+	var out []StoredDelegation
+	for rows.Next() {
+		var d StoredDelegation
+		if err := rows.Scan(&d.TzktID, &d.Level, &d.Delegator, &d.Amount, &d.Status); err != nil {
+			return nil, fmt.Errorf("scan delegation row: %w", err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return out, nil
+}
+
+func (s *auditStore) CountInRange(ctx context.Context, fromLevel, toLevel int64) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM delegations
+WHERE network = $1 AND level >= $2 AND level < $3
+`, s.network, fromLevel, toLevel).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count delegations in range: %w", err)
+	}
+	return n, nil
+}
+
+func (s *auditStore) SaveReconciliation(ctx context.Context, r Reconciliation) error {
+	repaired := r.RepairedIDs
+	if repaired == nil {
+		repaired = []int64{}
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO reconciliations (network, run_at, from_level, to_level, stored_count, source_count, repaired_ids, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+`, s.network, r.RunAt, r.FromLevel, r.ToLevel, r.StoredCount, r.SourceCount, pq.Array(repaired), r.Error)
+	if err != nil {
+		return fmt.Errorf("save reconciliation of [%d, %d): %w", r.FromLevel, r.ToLevel, err)
+	}
+	return nil
+}
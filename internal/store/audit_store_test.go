@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditStore_RangesAndReconciliations(t *testing.T) {
+	_, dbConn := setupTestStore(t)
+	ctx := context.Background()
+	network := "audit-" + time.Now().UTC().Format("20060102150405.000000000")
+	t.Cleanup(func() {
+		for _, table := range []string{"delegations", "reconciliations"} {
+			_, _ = dbConn.Exec(`DELETE FROM `+table+` WHERE network = $1`, network)
+		}
+	})
+
+	s := NewNetworkStore(dbConn, network)
+	audit := NewAuditStore(dbConn, network)
+
+	from, to, err := audit.LevelBounds(ctx)
+	require.NoError(t, err)
+	require.Zero(t, from)
+	require.Zero(t, to)
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.BulkInsert(ctx, []InsertDelegation{
+		{TzktID: 3, Timestamp: ts, Amount: 30, Delegator: "tz1c", Level: 30},
+		{TzktID: 1, Timestamp: ts, Amount: 10, Delegator: "tz1a", Level: 10},
+		{TzktID: 2, Timestamp: ts, Amount: 20, Delegator: "tz1b", Level: 20, Status: "failed"},
+	}))
+
+	from, to, err = audit.LevelBounds(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), from)
+	require.Equal(t, int64(30), to)
+
+	n, err := audit.CountInRange(ctx, 10, 30)
+	require.NoError(t, err)
+	require.Equal(t, 2, n, "the range excludes its end")
+
+	rows, err := audit.GetDelegationsInRange(ctx, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, []StoredDelegation{
+		{TzktID: 1, Level: 10, Delegator: "tz1a", Amount: 10, Status: "applied"},
+		{TzktID: 2, Level: 20, Delegator: "tz1b", Amount: 20, Status: "failed"},
+		{TzktID: 3, Level: 30, Delegator: "tz1c", Amount: 30, Status: "applied"},
+	}, rows)
+
+	require.NoError(t, audit.SaveReconciliation(ctx, Reconciliation{RunAt: ts, FromLevel: 1, ToLevel: 100, StoredCount: 3, SourceCount: 4, RepairedIDs: []int64{4}}))
+	require.NoError(t, audit.SaveReconciliation(ctx, Reconciliation{RunAt: ts, FromLevel: 100, ToLevel: 200, Error: "tzkt down"}))
+
+	var repaired, failed int
+	require.NoError(t, dbConn.QueryRow(`
+SELECT COUNT(*) FILTER (WHERE repaired_ids = '{4}'), COUNT(*) FILTER (WHERE error = 'tzkt down')
+FROM reconciliations WHERE network = $1`, network).Scan(&repaired, &failed))
+	require.Equal(t, 1, repaired)
+	require.Equal(t, 1, failed)
+}
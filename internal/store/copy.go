@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// copyMinRows is the smallest batch worth the round trips of a COPY: below
+// it, rows are inserted one by one.
+const copyMinRows = 100
+
+// copyRows streams rows into a staging table with COPY, then merges them
+// into delegations, skipping the ones already stored. The staging table is
+// temporary to the session and emptied at the end of each transaction.
+func copyRows(ctx context.Context, tx *sql.Tx, network string, rows []InsertDelegation) error {
+	if _, err := tx.ExecContext(ctx, `
+CREATE TEMP TABLE IF NOT EXISTS delegations_staging (
+    tzkt_id BIGINT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    amount BIGINT NOT NULL,
+    delegator TEXT NOT NULL,
+    level BIGINT NOT NULL,
+    baker TEXT,
+    baker_alias TEXT,
+    previous_baker TEXT,
+    previous_baker_alias TEXT,
+    status TEXT,
+    errors TEXT[]
+) ON COMMIT DELETE ROWS`); err != nil {
+		return fmt.Errorf("create staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("delegations_staging",
+		"tzkt_id", "timestamp", "amount", "delegator", "level",
+		"baker", "baker_alias", "previous_baker", "previous_baker_alias", "status", "errors"))
+	if err != nil {
+		return fmt.Errorf("prepare copy: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, r := range rows {
+		if _, err := stmt.ExecContext(ctx,
+			r.TzktID,
+			r.Timestamp,
+			r.Amount,
+			r.Delegator,
+			r.Level,
+			r.Baker,
+			r.BakerAlias,
+			r.PreviousBaker,
+			r.PreviousBakerAlias,
+			r.Status,
+			pq.Array(r.Errors),
+		); err != nil {
+			return fmt.Errorf("copy delegation tzkt_id=%d: %w", r.TzktID, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("flush copy: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO delegations (network, tzkt_id, timestamp, amount, delegator, level, year,
+                         baker, baker_alias, previous_baker, previous_baker_alias, status, errors)
+SELECT $1, tzkt_id, timestamp, amount, delegator, level, EXTRACT(YEAR FROM timestamp)::INT,
+       NULLIF(baker, ''), NULLIF(baker_alias, ''), NULLIF(previous_baker, ''), NULLIF(previous_baker_alias, ''),
+       COALESCE(NULLIF(status, ''), 'applied'), errors
+FROM delegations_staging
+ORDER BY tzkt_id
+ON CONFLICT (network, tzkt_id) DO NOTHING`, network); err != nil {
+		return fmt.Errorf("merge staged delegations: %w", err)
+	}
+
+	// A transaction may copy more than one batch.
+	if _, err := tx.ExecContext(ctx, `TRUNCATE delegations_staging`); err != nil {
+		return fmt.Errorf("empty staging table: %w", err)
+	}
+	return nil
+}
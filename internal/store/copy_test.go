@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// realisticBatch returns n delegations shaped like mainnet's: most with a
+// baker and an alias, some undelegations and some failed ones.
+func realisticBatch(firstID int64, n int) []InsertDelegation {
+	ts := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	rows := make([]InsertDelegation, n)
+	for i := range rows {
+		id := firstID + int64(i)
+		r := InsertDelegation{
+			TzktID:             id,
+			Timestamp:          ts.Add(time.Duration(i) * 15 * time.Second),
+			Amount:             id * 1000,
+			Delegator:          fmt.Sprintf("tz1delegator%030d", id),
+			Level:              3000000 + id/3,
+			Baker:              fmt.Sprintf("tz1baker%034d", id%400),
+			BakerAlias:         fmt.Sprintf("Baker %d", id%400),
+			PreviousBaker:      fmt.Sprintf("tz1baker%034d", (id+1)%400),
+			PreviousBakerAlias: "",
+		}
+		switch {
+		case i%50 == 0:
+			r.Baker, r.BakerAlias = "", ""
+		case i%97 == 0:
+			r.Status = "failed"
+			r.Errors = []string{"delegate.unchanged"}
+		}
+		rows[i] = r
+	}
+	return rows
+}
+
+func insertInTx(ctx context.Context, dbConn *sql.DB, insert func(context.Context, *sql.Tx, string, []InsertDelegation) error, network string, rows []InsertDelegation) error {
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := insert(ctx, tx, network, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestCopyRows_StoresWhatExecRowsStores(t *testing.T) {
+	_, dbConn := setupTestStore(t)
+	ctx := context.Background()
+	suffix := time.Now().UTC().Format("20060102150405.000000000")
+	copied, inserted := "copy-"+suffix, "exec-"+suffix
+	t.Cleanup(func() {
+		_, _ = dbConn.Exec(`DELETE FROM delegations WHERE network IN ($1, $2)`, copied, inserted)
+	})
+
+	rows := realisticBatch(1, 300)
+	require.NoError(t, insertInTx(ctx, dbConn, copyRows, copied, rows[:200]))
+	// Overlapping and duplicated rows are skipped, in one or more batches.
+	require.NoError(t, insertInTx(ctx, dbConn, func(ctx context.Context, tx *sql.Tx, network string, rows []InsertDelegation) error {
+		if err := copyRows(ctx, tx, network, rows); err != nil {
+			return err
+		}
+		return copyRows(ctx, tx, network, append(rows, rows[0]))
+	}, copied, rows[100:]))
+	require.NoError(t, insertInTx(ctx, dbConn, execRows, inserted, rows))
+
+	dump := func(network string) []Delegation {
+		page, err := NewNetworkStore(dbConn, network).GetPage(ctx, DelegationFilter{Statuses: []string{"applied", "failed"}}, 1000, 0)
+		require.NoError(t, err)
+		for i := range page {
+			page[i].ID = 0 // row ids differ between the networks
+		}
+		return page
+	}
+	got := dump(copied)
+	require.Len(t, got, 300)
+	require.Equal(t, dump(inserted), got)
+}
+
+func TestBulkInsert_CopiesLargeBatches(t *testing.T) {
+	_, dbConn := setupTestStore(t)
+	ctx := context.Background()
+	network := "bulk-" + time.Now().UTC().Format("20060102150405.000000000")
+	t.Cleanup(func() {
+		_, _ = dbConn.Exec(`DELETE FROM delegations WHERE network = $1`, network)
+	})
+
+	s := NewNetworkStore(dbConn, network)
+	rows := realisticBatch(1, 2*copyMinRows)
+	require.NoError(t, s.BulkInsert(ctx, rows))
+	require.NoError(t, s.BulkInsert(ctx, rows))
+	require.NoError(t, s.SaveBatch(ctx, realisticBatch(1, 3*copyMinRows), SyncState{Name: "delegations", CursorID: 3 * copyMinRows}))
+
+	var n int
+	require.NoError(t, dbConn.QueryRow(`SELECT COUNT(*) FROM delegations WHERE network = $1`, network).Scan(&n))
+	require.Equal(t, 3*copyMinRows, n)
+}
+
+// BenchmarkInsertRows compares both ingestion paths on a backfill batch of
+// new delegations: go test ./internal/store -run '^$' -bench InsertRows
+func BenchmarkInsertRows(b *testing.B) {
+	_, dbConn := setupTestStore(b)
+	ctx := context.Background()
+	const batch = 10000
+
+	for _, bc := range []struct {
+		name   string
+		insert func(context.Context, *sql.Tx, string, []InsertDelegation) error
+	}{
+		{"copy", copyRows},
+		{"exec", execRows},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			network := "bench-" + bc.name + "-" + time.Now().UTC().Format("20060102150405.000000000")
+			b.Cleanup(func() {
+				_, _ = dbConn.Exec(`DELETE FROM delegations WHERE network = $1`, network)
+			})
+
+			for i := range b.N {
+				rows := realisticBatch(int64(i)*batch+1, batch)
+				if err := insertInTx(ctx, dbConn, bc.insert, network, rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
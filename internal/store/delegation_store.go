@@ -3,37 +3,147 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Delegation struct {
-	Timestamp time.Time `json:"timestamp"`
-	Amount    int64     `json:"amount"`
-	Delegator string    `json:"delegator"`
-	Level     int64     `json:"level"`
+	// ID is the row id, which orders delegations of the same timestamp.
+	ID                 int64     `json:"id"`
+	Timestamp          time.Time `json:"timestamp"`
+	Amount             int64     `json:"amount"`
+	Delegator          string    `json:"delegator"`
+	Level              int64     `json:"level"`
+	Baker              string    `json:"baker"`
+	BakerAlias         string    `json:"baker_alias"`
+	PreviousBaker      string    `json:"previous_baker"`
+	PreviousBakerAlias string    `json:"previous_baker_alias"`
+	Status             string    `json:"status"`
+	// Errors are the TzKT error types of a delegation that was not applied.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DelegationFilter selects the delegations returned by GetPage. Zero fields
+// do not filter.
+type DelegationFilter struct {
+	Year *int
+	// Statuses keeps the delegations with one of these statuses.
+	Statuses []string
+	// Delegator and Baker keep the delegations of an address, Baker being
+	// the baker delegated to.
+	Delegator string
+	Baker     string
+	// MinLevel, MaxLevel, MinAmount and MaxAmount are inclusive bounds.
+	MinLevel  *int64
+	MaxLevel  *int64
+	MinAmount *int64
+	MaxAmount *int64
+	// From and To bound the timestamp, From inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+}
+
+// PageCursor is the position of a delegation in the newest-first order of
+// GetPage.
+type PageCursor struct {
+	Timestamp time.Time
+	ID        int64
 }
 
 type DelegationStore interface {
 	BulkInsert(ctx context.Context, rows []InsertDelegation) error
-	GetPage(ctx context.Context, year *int, limit, offset int) ([]Delegation, error)
-	GetLastSeen(ctx context.Context) (time.Time, int64, error)
+	GetPage(ctx context.Context, filter DelegationFilter, limit, offset int) ([]Delegation, error)
+	// GetPageAfter returns the delegations following after in the order of
+	// GetPage, or the first ones when after is nil. Unlike an offset, the
+	// position is not shifted by delegations inserted in the meantime.
+	GetPageAfter(ctx context.Context, filter DelegationFilter, after *PageCursor, limit int) ([]Delegation, error)
+	// GetDelegatorHistory returns the applied delegations of an address,
+	// oldest first: each one ends the delegation period of the previous one.
+	GetDelegatorHistory(ctx context.Context, delegator string) ([]Delegation, error)
+	// GetBakerDelegators returns the delegation by which each current
+	// delegator of baker joined it, most recent first.
+	GetBakerDelegators(ctx context.Context, baker string, limit, offset int) ([]Delegation, error)
+	// GetBakerEvents returns the applied delegations to or away from baker,
+	// most recent first, optionally in a year.
+	GetBakerEvents(ctx context.Context, baker string, year *int, limit, offset int) ([]Delegation, error)
+	SaveBatch(ctx context.Context, rows []InsertDelegation, state SyncState) error
+	GetSyncState(ctx context.Context, name string) (SyncState, error)
+	SaveBlocks(ctx context.Context, blocks []Block) error
+	GetBlocksFrom(ctx context.Context, fromLevel int64) ([]Block, error)
+	PruneBlocks(ctx context.Context, belowLevel int64) error
+	Rollback(ctx context.Context, name string, fromLevel int64) (SyncState, error)
+	CreateBackfillRanges(ctx context.Context, name string, ranges []BackfillRange) error
+	GetBackfillRanges(ctx context.Context, name string) ([]BackfillRange, error)
+	SaveBackfillBatch(ctx context.Context, name string, rows []InsertDelegation, r BackfillRange) error
+	GetBoundaryLevels(ctx context.Context) ([]int64, error)
+	IsRepairDone(ctx context.Context, name string) (bool, error)
+	MarkRepairDone(ctx context.Context, name string) error
+}
+
+// SyncState is a checkpoint of how far an ingestion pipeline has synced.
+type SyncState struct {
+	Name string
+	// CursorID is the TzKT operation id of the last synced operation.
+	CursorID      int64
+	Level         int64
+	Timestamp     time.Time
+	BatchCount    int64
+	LastSuccessAt time.Time
+}
+
+// BackfillRange is a level range [FromLevel, ToLevel) of a historical backfill
+// with its own checkpoint.
+type BackfillRange struct {
+	FromLevel int64
+	ToLevel   int64
+	// CursorID is the TzKT operation id of the last operation synced in the range.
+	CursorID int64
+	Done     bool
+}
+
+// Block is the hash recorded for a level of the synced head window.
+type Block struct {
+	Level     int64
+	Hash      string
+	Timestamp time.Time
 }
 
+// DefaultNetwork is the network of rows ingested before networks were
+// introduced, and of the store returned by NewDelegationStore.
+const DefaultNetwork = "mainnet"
+
 type delegationStore struct {
-	db *sql.DB
+	db      *sql.DB
+	network string
 }
 
 func NewDelegationStore(db *sql.DB) DelegationStore {
-	return &delegationStore{db: db}
+	return NewNetworkStore(db, DefaultNetwork)
+}
+
+// NewNetworkStore returns a DelegationStore scoped to a single network: every
+// read and write, checkpoints included, is limited to that network's rows.
+func NewNetworkStore(db *sql.DB, network string) DelegationStore {
+	return &delegationStore{db: db, network: network}
 }
 
 type InsertDelegation struct {
-	TzktID    int64
-	Timestamp time.Time
-	Amount    int64
-	Delegator string
-	Level     int64
+	TzktID             int64
+	Timestamp          time.Time
+	Amount             int64
+	Delegator          string
+	Level              int64
+	Baker              string
+	BakerAlias         string
+	PreviousBaker      string
+	PreviousBakerAlias string
+	// Status is applied when empty.
+	Status string
+	Errors []string
 }
 
 func (s *delegationStore) BulkInsert(ctx context.Context, rows []InsertDelegation) error {
@@ -49,10 +159,94 @@ func (s *delegationStore) BulkInsert(ctx context.Context, rows []InsertDelegatio
 		_ = tx.Rollback()
 	}(tx)
 
+	if err := insertRows(ctx, tx, s.network, rows); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SaveBatch inserts rows and advances the named sync checkpoint in a single
+// transaction, so the cursor never points past data that was not committed.
+func (s *delegationStore) SaveBatch(ctx context.Context, rows []InsertDelegation, state SyncState) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := insertRows(ctx, tx, s.network, rows); err != nil {
+		return err
+	}
+
+	if err := saveSyncState(ctx, tx, s.network, state); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// saveSyncState advances the named checkpoint of a network within tx.
+func saveSyncState(ctx context.Context, tx *sql.Tx, network string, state SyncState) error {
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO sync_state (network, name, cursor_id, level, timestamp, batch_count, last_success_at)
+VALUES ($1, $2, $3, $4, $5, 1, NOW())
+ON CONFLICT (network, name) DO UPDATE SET
+    cursor_id = EXCLUDED.cursor_id,
+    level = EXCLUDED.level,
+    timestamp = EXCLUDED.timestamp,
+    batch_count = sync_state.batch_count + 1,
+    last_success_at = EXCLUDED.last_success_at
+`, network, state.Name, state.CursorID, state.Level, state.Timestamp); err != nil {
+		return fmt.Errorf("update sync state %q: %w", state.Name, err)
+	}
+	return nil
+}
+
+// insertRows adds rows to the delegations of network, skipping the ones
+// already stored. Batches of copyMinRows rows or more are copied, the others,
+// or a batch the server refused to copy, inserted row by row.
+func insertRows(ctx context.Context, tx *sql.Tx, network string, rows []InsertDelegation) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if len(rows) < copyMinRows {
+		return execRows(ctx, tx, network, rows)
+	}
+
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT copy_rows`); err != nil {
+		return fmt.Errorf("create savepoint: %w", err)
+	}
+	err := copyRows(ctx, tx, network, rows)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT copy_rows`); rbErr != nil {
+		return errors.Join(err, fmt.Errorf("rollback to savepoint: %w", rbErr))
+	}
+	return execRows(ctx, tx, network, rows)
+}
+
+// execRows inserts rows one prepared statement at a time.
+func execRows(ctx context.Context, tx *sql.Tx, network string, rows []InsertDelegation) error {
 	stmt, err := tx.PrepareContext(ctx, `
-INSERT INTO delegations (tzkt_id, timestamp, amount, delegator, level, year)
-VALUES ($1, $2, $3, $4, $5, EXTRACT(YEAR FROM $2::TIMESTAMPTZ)::INT)
-ON CONFLICT (tzkt_id) DO NOTHING`)
+INSERT INTO delegations (network, tzkt_id, timestamp, amount, delegator, level, year,
+                         baker, baker_alias, previous_baker, previous_baker_alias, status, errors)
+VALUES ($1, $2, $3, $4, $5, $6, EXTRACT(YEAR FROM $3::TIMESTAMPTZ)::INT,
+        NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''),
+        COALESCE(NULLIF($11, ''), 'applied'), $12)
+ON CONFLICT (network, tzkt_id) DO NOTHING`)
 	if err != nil {
 		return fmt.Errorf("prepare statement: %w", err)
 	}
@@ -60,54 +254,162 @@ ON CONFLICT (tzkt_id) DO NOTHING`)
 
 	for _, r := range rows {
 		if _, err := stmt.ExecContext(ctx,
+			network,
 			r.TzktID,
 			r.Timestamp,
 			r.Amount,
 			r.Delegator,
 			r.Level,
+			r.Baker,
+			r.BakerAlias,
+			r.PreviousBaker,
+			r.PreviousBakerAlias,
+			r.Status,
+			pq.Array(r.Errors),
 		); err != nil {
 			return fmt.Errorf("insert delegation tzkt_id=%d: %w", r.TzktID, err)
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
-	}
 	return nil
 }
 
-func (s *delegationStore) GetPage(ctx context.Context, year *int, limit, offset int) ([]Delegation, error) {
-	var rows *sql.Rows
-	var err error
+func (s *delegationStore) GetPage(ctx context.Context, filter DelegationFilter, limit, offset int) ([]Delegation, error) {
+	return s.getPage(ctx, filter, nil, limit, offset)
+}
+
+func (s *delegationStore) GetPageAfter(ctx context.Context, filter DelegationFilter, after *PageCursor, limit int) ([]Delegation, error) {
+	return s.getPage(ctx, filter, after, limit, 0)
+}
+
+func (s *delegationStore) getPage(ctx context.Context, filter DelegationFilter, after *PageCursor, limit, offset int) ([]Delegation, error) {
+	where := []string{"network = $1"}
+	args := []any{s.network}
+	if filter.Year != nil {
+		args = append(args, *filter.Year)
+		where = append(where, fmt.Sprintf("year = $%d", len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		where = append(where, fmt.Sprintf("status = ANY($%d)", len(args)))
+	}
+	for _, cond := range []struct {
+		set   bool
+		value any
+		expr  string
+	}{
+		{filter.Delegator != "", filter.Delegator, "delegator = $%d"},
+		{filter.Baker != "", filter.Baker, "baker = $%d"},
+		{filter.MinLevel != nil, filter.MinLevel, "level >= $%d"},
+		{filter.MaxLevel != nil, filter.MaxLevel, "level <= $%d"},
+		{filter.MinAmount != nil, filter.MinAmount, "amount >= $%d"},
+		{filter.MaxAmount != nil, filter.MaxAmount, "amount <= $%d"},
+		{!filter.From.IsZero(), filter.From, "timestamp >= $%d"},
+		{!filter.To.IsZero(), filter.To, "timestamp < $%d"},
+	} {
+		if cond.set {
+			args = append(args, cond.value)
+			where = append(where, fmt.Sprintf(cond.expr, len(args)))
+		}
+	}
+	if after != nil {
+		args = append(args, after.Timestamp, after.ID)
+		where = append(where, fmt.Sprintf("(timestamp, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, limit, offset)
 
-	if year != nil {
-		rows, err = s.db.QueryContext(ctx, `
-SELECT timestamp, amount, delegator, level
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT id, timestamp, amount, delegator, level,
+       COALESCE(baker, ''), COALESCE(baker_alias, ''),
+       COALESCE(previous_baker, ''), COALESCE(previous_baker_alias, ''),
+       status, errors
 FROM delegations
-WHERE year = $1
+WHERE %s
 ORDER BY timestamp DESC, id DESC
-LIMIT $2 OFFSET $3
-`, *year, limit, offset)
-		if err != nil {
-			return nil, fmt.Errorf("query delegations for year %d: %w", *year, err)
-		}
-	} else {
-		rows, err = s.db.QueryContext(ctx, `
-SELECT timestamp, amount, delegator, level
+LIMIT $%d OFFSET $%d
+`, strings.Join(where, " AND "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query delegations: %w", err)
+	}
+	return scanDelegations(rows, limit)
+}
+
+// GetDelegatorHistory returns the applied delegations of delegator, oldest
+// first, read through idx_delegations_network_delegator_timestamp_id_desc.
+func (s *delegationStore) GetDelegatorHistory(ctx context.Context, delegator string) ([]Delegation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, timestamp, amount, delegator, level,
+       COALESCE(baker, ''), COALESCE(baker_alias, ''),
+       COALESCE(previous_baker, ''), COALESCE(previous_baker_alias, ''),
+       status, errors
 FROM delegations
+WHERE network = $1 AND delegator = $2 AND status = 'applied'
+ORDER BY timestamp, id
+`, s.network, delegator)
+	if err != nil {
+		return nil, fmt.Errorf("query delegator history: %w", err)
+	}
+	return scanDelegations(rows, 0)
+}
+
+func (s *delegationStore) GetBakerDelegators(ctx context.Context, baker string, limit, offset int) ([]Delegation, error) {
+	// The latest delegation of every address that ever delegated to baker,
+	// kept when it is still to baker.
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, timestamp, amount, delegator, level, baker, baker_alias, previous_baker, previous_baker_alias, status, errors
+FROM (
+    SELECT DISTINCT ON (delegator)
+           id, timestamp, amount, delegator, level,
+           COALESCE(baker, '') AS baker, COALESCE(baker_alias, '') AS baker_alias,
+           COALESCE(previous_baker, '') AS previous_baker, COALESCE(previous_baker_alias, '') AS previous_baker_alias,
+           status, errors
+    FROM delegations
+    WHERE network = $1 AND status = 'applied'
+      AND delegator IN (
+          SELECT delegator FROM delegations
+          WHERE network = $1 AND baker = $2 AND status = 'applied'
+      )
+    ORDER BY delegator, timestamp DESC, id DESC
+) latest
+WHERE baker = $2
 ORDER BY timestamp DESC, id DESC
-LIMIT $1 OFFSET $2
-`, limit, offset)
-		if err != nil {
-			return nil, fmt.Errorf("query delegations: %w", err)
-		}
+LIMIT $3 OFFSET $4
+`, s.network, baker, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query baker delegators: %w", err)
 	}
+	return scanDelegations(rows, limit)
+}
+
+func (s *delegationStore) GetBakerEvents(ctx context.Context, baker string, year *int, limit, offset int) ([]Delegation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, timestamp, amount, delegator, level,
+       COALESCE(baker, ''), COALESCE(baker_alias, ''),
+       COALESCE(previous_baker, ''), COALESCE(previous_baker_alias, ''),
+       status, errors
+FROM delegations
+WHERE network = $1 AND status = 'applied' AND (baker = $2 OR previous_baker = $2)
+  AND ($3::INT IS NULL OR year = $3)
+ORDER BY timestamp DESC, id DESC
+LIMIT $4 OFFSET $5
+`, s.network, baker, year, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query baker events: %w", err)
+	}
+	return scanDelegations(rows, limit)
+}
+
+// scanDelegations reads and closes rows selected in the order of Delegation's fields.
+func scanDelegations(rows *sql.Rows, capacity int) ([]Delegation, error) {
 	defer rows.Close()
 
-	out := make([]Delegation, 0, limit)
+	out := make([]Delegation, 0, capacity)
 	for rows.Next() {
 		var d Delegation
-		if err := rows.Scan(&d.Timestamp, &d.Amount, &d.Delegator, &d.Level); err != nil {
+		if err := rows.Scan(
+			&d.ID, &d.Timestamp, &d.Amount, &d.Delegator, &d.Level,
+			&d.Baker, &d.BakerAlias, &d.PreviousBaker, &d.PreviousBakerAlias,
+			&d.Status, pq.Array(&d.Errors),
+		); err != nil {
 			return nil, fmt.Errorf("scan delegation row: %w", err)
 		}
 		out = append(out, d)
@@ -118,16 +420,286 @@ LIMIT $1 OFFSET $2
 	return out, nil
 }
 
-func (s *delegationStore) GetLastSeen(ctx context.Context) (time.Time, int64, error) {
-	var ts time.Time
-	var lvl sql.NullInt64
+// GetSyncState returns the named sync checkpoint. A checkpoint that was never
+// saved is returned with a zero cursor.
+func (s *delegationStore) GetSyncState(ctx context.Context, name string) (SyncState, error) {
+	return getSyncState(ctx, s.db, s.network, name)
+}
 
+func getSyncState(ctx context.Context, db *sql.DB, network, name string) (SyncState, error) {
+	state := SyncState{Name: name}
+	var ts, lastSuccess sql.NullTime
+
+	err := db.QueryRowContext(ctx, `
+SELECT cursor_id, level, timestamp, batch_count, last_success_at
+FROM sync_state
+WHERE network = $1 AND name = $2
+`, network, name).Scan(&state.CursorID, &state.Level, &ts, &state.BatchCount, &lastSuccess)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return SyncState{}, fmt.Errorf("query sync state %q: %w", name, err)
+	}
+	state.Timestamp = ts.Time
+	state.LastSuccessAt = lastSuccess.Time
+	return state, nil
+}
+
+// GetBoundaryLevels returns, in ascending order, the levels where a batch of
+// the former timestamp-cursor poller ended. They were taken from the
+// transaction ids of the rows by migration 000014, before anything could
+// rewrite the table.
+func (s *delegationStore) GetBoundaryLevels(ctx context.Context) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT level
+FROM batch_boundaries
+WHERE network = $1
+ORDER BY level
+`, s.network)
+	if err != nil {
+		return nil, fmt.Errorf("query boundary levels: %w", err)
+	}
+	defer rows.Close()
+
+	var out []int64
+	for rows.Next() {
+		var lvl int64
+		if err := rows.Scan(&lvl); err != nil {
+			return nil, fmt.Errorf("scan boundary level: %w", err)
+		}
+		out = append(out, lvl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return out, nil
+}
+
+// IsRepairDone reports whether the named one-time repair has already completed.
+func (s *delegationStore) IsRepairDone(ctx context.Context, name string) (bool, error) {
+	var done bool
 	err := s.db.QueryRowContext(ctx, `
-SELECT COALESCE(MAX(timestamp), '0001-01-01'), COALESCE(MAX(level), 0)
+SELECT EXISTS (SELECT 1 FROM repairs WHERE network = $1 AND name = $2)
+`, s.network, name).Scan(&done)
+	if err != nil {
+		return false, fmt.Errorf("query repair %q: %w", name, err)
+	}
+	return done, nil
+}
+
+// MarkRepairDone records the named one-time repair as completed.
+func (s *delegationStore) MarkRepairDone(ctx context.Context, name string) error {
+	if _, err := s.db.ExecContext(ctx, `
+INSERT INTO repairs (network, name) VALUES ($1, $2)
+ON CONFLICT (network, name) DO NOTHING
+`, s.network, name); err != nil {
+		return fmt.Errorf("mark repair %q done: %w", name, err)
+	}
+	return nil
+}
+
+// SaveBlocks records the hash of each block, replacing any hash already stored for its level.
+func (s *delegationStore) SaveBlocks(ctx context.Context, blocks []Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO blocks (network, level, hash, timestamp)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (network, level) DO UPDATE SET hash = EXCLUDED.hash, timestamp = EXCLUDED.timestamp`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, b := range blocks {
+		if _, err := stmt.ExecContext(ctx, s.network, b.Level, b.Hash, b.Timestamp); err != nil {
+			return fmt.Errorf("insert block level=%d: %w", b.Level, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetBlocksFrom returns the recorded blocks at or above fromLevel, ordered by level.
+func (s *delegationStore) GetBlocksFrom(ctx context.Context, fromLevel int64) ([]Block, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT level, hash, timestamp
+FROM blocks
+WHERE network = $1 AND level >= $2
+ORDER BY level
+`, s.network, fromLevel)
+	if err != nil {
+		return nil, fmt.Errorf("query blocks from level %d: %w", fromLevel, err)
+	}
+	defer rows.Close()
+
+	var out []Block
+	for rows.Next() {
+		var b Block
+		if err := rows.Scan(&b.Level, &b.Hash, &b.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan block row: %w", err)
+		}
+		out = append(out, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return out, nil
+}
+
+// PruneBlocks forgets the blocks below belowLevel, which have left the head window.
+func (s *delegationStore) PruneBlocks(ctx context.Context, belowLevel int64) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM blocks WHERE network = $1 AND level < $2`, s.network, belowLevel); err != nil {
+		return fmt.Errorf("prune blocks below level %d: %w", belowLevel, err)
+	}
+	return nil
+}
+
+// Rollback deletes every delegation and block at or above fromLevel and
+// rewinds the named sync checkpoint to the last delegation that remains.
+// It returns the rewound checkpoint.
+func (s *delegationStore) Rollback(ctx context.Context, name string, fromLevel int64) (SyncState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SyncState{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM delegations WHERE network = $1 AND level >= $2`, s.network, fromLevel); err != nil {
+		return SyncState{}, fmt.Errorf("delete delegations from level %d: %w", fromLevel, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM blocks WHERE network = $1 AND level >= $2`, s.network, fromLevel); err != nil {
+		return SyncState{}, fmt.Errorf("delete blocks from level %d: %w", fromLevel, err)
+	}
+
+	state := SyncState{Name: name}
+	var ts sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+SELECT tzkt_id, level, timestamp
 FROM delegations
-`).Scan(&ts, &lvl)
+WHERE network = $1
+ORDER BY tzkt_id DESC
+LIMIT 1
+`, s.network).Scan(&state.CursorID, &state.Level, &ts)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return SyncState{}, fmt.Errorf("query last remaining delegation: %w", err)
+	}
+	state.Timestamp = ts.Time
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE sync_state
+SET cursor_id = $3, level = $4, timestamp = $5
+WHERE network = $1 AND name = $2
+`, s.network, name, state.CursorID, state.Level, ts); err != nil {
+		return SyncState{}, fmt.Errorf("rewind sync state %q: %w", name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return SyncState{}, fmt.Errorf("commit transaction: %w", err)
+	}
+	return state, nil
+}
+
+// CreateBackfillRanges records the planned ranges of the named backfill.
+// Ranges that already exist keep their checkpoint.
+func (s *delegationStore) CreateBackfillRanges(ctx context.Context, name string, ranges []BackfillRange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO backfill_ranges (network, name, from_level, to_level)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (network, name, from_level) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, r := range ranges {
+		if _, err := stmt.ExecContext(ctx, s.network, name, r.FromLevel, r.ToLevel); err != nil {
+			return fmt.Errorf("insert backfill range %d-%d: %w", r.FromLevel, r.ToLevel, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetBackfillRanges returns the ranges of the named backfill ordered by level.
+func (s *delegationStore) GetBackfillRanges(ctx context.Context, name string) ([]BackfillRange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT from_level, to_level, cursor_id, done
+FROM backfill_ranges
+WHERE network = $1 AND name = $2
+ORDER BY from_level
+`, s.network, name)
 	if err != nil {
-		return time.Time{}, 0, fmt.Errorf("query last seen: %w", err)
+		return nil, fmt.Errorf("query backfill ranges %q: %w", name, err)
+	}
+	defer rows.Close()
+
+	var out []BackfillRange
+	for rows.Next() {
+		var r BackfillRange
+		if err := rows.Scan(&r.FromLevel, &r.ToLevel, &r.CursorID, &r.Done); err != nil {
+			return nil, fmt.Errorf("scan backfill range: %w", err)
+		}
+		out = append(out, r)
 	}
-	return ts, lvl.Int64, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return out, nil
+}
+
+// SaveBackfillBatch inserts rows and advances the checkpoint of the backfill
+// range in a single transaction.
+func (s *delegationStore) SaveBackfillBatch(ctx context.Context, name string, rows []InsertDelegation, r BackfillRange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := insertRows(ctx, tx, s.network, rows); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE backfill_ranges
+SET cursor_id = $4, done = $5, updated_at = NOW()
+WHERE network = $1 AND name = $2 AND from_level = $3
+`, s.network, name, r.FromLevel, r.CursorID, r.Done); err != nil {
+		return fmt.Errorf("update backfill range %d-%d: %w", r.FromLevel, r.ToLevel, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
 }
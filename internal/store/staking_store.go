@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StakingOperation is a stored stake, unstake or finalize operation.
+type StakingOperation struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Level      int64     `json:"level"`
+	Staker     string    `json:"staker"`
+	Baker      string    `json:"baker"`
+	BakerAlias string    `json:"baker_alias"`
+	Action     string    `json:"action"`
+	Amount     int64     `json:"amount"`
+}
+
+type InsertStakingOperation struct {
+	TzktID     int64
+	Timestamp  time.Time
+	Level      int64
+	Staker     string
+	Baker      string
+	BakerAlias string
+	Action     string
+	Amount     int64
+}
+
+// StakingStore stores the staking operations of a network. Its checkpoint
+// lives in sync_state next to the delegation checkpoints.
+type StakingStore interface {
+	// SaveStakingBatch inserts rows and advances the named checkpoint in a
+	// single transaction.
+	SaveStakingBatch(ctx context.Context, rows []InsertStakingOperation, state SyncState) error
+	GetSyncState(ctx context.Context, name string) (SyncState, error)
+	GetStakingPage(ctx context.Context, year *int, limit, offset int) ([]StakingOperation, error)
+}
+
+type stakingStore struct {
+	db      *sql.DB
+	network string
+}
+
+// NewStakingStore returns a StakingStore scoped to a single network.
+func NewStakingStore(db *sql.DB, network string) StakingStore {
+	return &stakingStore{db: db, network: network}
+}
+
+func (s *stakingStore) SaveStakingBatch(ctx context.Context, rows []InsertStakingOperation, state SyncState) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if len(rows) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO staking_operations (network, tzkt_id, timestamp, level, year, staker,
+                                baker, baker_alias, action, amount)
+VALUES ($1, $2, $3, $4, EXTRACT(YEAR FROM $3::TIMESTAMPTZ)::INT, $5,
+        NULLIF($6, ''), NULLIF($7, ''), $8, $9)
+ON CONFLICT (network, tzkt_id) DO NOTHING`)
+		if err != nil {
+			return fmt.Errorf("prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, r := range rows {
+			if _, err := stmt.ExecContext(ctx,
+				s.network,
+				r.TzktID,
+				r.Timestamp,
+				r.Level,
+				r.Staker,
+				r.Baker,
+				r.BakerAlias,
+				r.Action,
+				r.Amount,
+			); err != nil {
+				return fmt.Errorf("insert staking operation tzkt_id=%d: %w", r.TzktID, err)
+			}
+		}
+	}
+
+	if err := saveSyncState(ctx, tx, s.network, state); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *stakingStore) GetSyncState(ctx context.Context, name string) (SyncState, error) {
+	return getSyncState(ctx, s.db, s.network, name)
+}
+
+func (s *stakingStore) GetStakingPage(ctx context.Context, year *int, limit, offset int) ([]StakingOperation, error) {
+	where := []string{"network = $1"}
+	args := []any{s.network}
+	if year != nil {
+		args = append(args, *year)
+		where = append(where, fmt.Sprintf("year = $%d", len(args)))
+	}
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT timestamp, level, staker, COALESCE(baker, ''), COALESCE(baker_alias, ''), action, amount
+FROM staking_operations
+WHERE %s
+ORDER BY timestamp DESC, id DESC
+LIMIT $%d OFFSET $%d
+`, strings.Join(where, " AND "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query staking operations: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]StakingOperation, 0, limit)
+	for rows.Next() {
+		var op StakingOperation
+		if err := rows.Scan(&op.Timestamp, &op.Level, &op.Staker, &op.Baker, &op.BakerAlias, &op.Action, &op.Amount); err != nil {
+			return nil, fmt.Errorf("scan staking operation row: %w", err)
+		}
+		out = append(out, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return out, nil
+}
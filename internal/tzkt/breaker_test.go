@@ -0,0 +1,91 @@
+package tzkt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_OpensAfterThresholdAndProbes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(3, time.Minute)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		b.Failure()
+	}
+	require.Equal(t, BreakerClosed, b.State())
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, BreakerOpen, b.State())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// After the cooldown a single trial call goes through.
+	now = now.Add(time.Minute)
+	require.Equal(t, BreakerHalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// A failed trial reopens it for another cooldown.
+	b.Failure()
+	require.Equal(t, BreakerOpen, b.State())
+	now = now.Add(30 * time.Second)
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, b.Allow())
+	b.Success()
+	require.Equal(t, BreakerClosed, b.State())
+	require.NoError(t, b.Allow())
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.NoError(t, b.Allow())
+	b.Success()
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreaker_StaleSuccessKeepsItOpen(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	// A slow call is allowed, then another one fails and opens the breaker.
+	require.NoError(t, b.Allow())
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, BreakerOpen, b.State())
+
+	b.Success()
+	require.Equal(t, BreakerOpen, b.State())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// Once half-open, only the trial call closes it.
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Success()
+	require.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreaker_ReleaseFreesTrialCall(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	now = now.Add(time.Minute)
+
+	require.NoError(t, b.Allow())
+	b.Release()
+	require.NoError(t, b.Allow())
+}
@@ -3,31 +3,107 @@ package tzkt
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
+// maxLimit is the largest page size accepted by the TzKT API.
+const maxLimit = 10000
+
 type Client interface {
+	// FetchDelegations returns up to limit delegations strictly after since, ordered by id.
 	FetchDelegations(ctx context.Context, since time.Time, limit int) ([]Delegation, error)
+	// FetchDelegationsAfterID returns up to limit delegations with an id greater than afterID, ordered by id.
+	FetchDelegationsAfterID(ctx context.Context, afterID int64, limit int) ([]Delegation, error)
+	// FetchDelegationsAtLevel returns every delegation included in the block at level.
+	FetchDelegationsAtLevel(ctx context.Context, level int64) ([]Delegation, error)
+	// FetchDelegationsInRange returns up to limit delegations with a level in
+	// [fromLevel, toLevel) and an id greater than afterID, ordered by id.
+	FetchDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit int) ([]Delegation, error)
+	// StreamDelegationsInRange is FetchDelegationsInRange for large batches:
+	// it decodes the response incrementally and calls handle with consecutive
+	// chunks of at most chunkSize delegations, so memory is bounded by
+	// chunkSize rather than limit. The chunk is reused once handle returns. It
+	// returns the number of delegations read, and stops at the first error
+	// returned by handle.
+	StreamDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit, chunkSize int, handle func([]Delegation) error) (int, error)
+	// CountDelegationsInRange returns the number of delegations, whatever
+	// their status, with a level in [fromLevel, toLevel).
+	CountDelegationsInRange(ctx context.Context, fromLevel, toLevel int64) (int, error)
+	// FetchBlocks returns up to limit blocks starting at fromLevel, ordered by level.
+	FetchBlocks(ctx context.Context, fromLevel int64, limit int) ([]Block, error)
+	// FetchHead returns the latest block known to TzKT.
+	FetchHead(ctx context.Context) (Block, error)
+	// FetchStakingAfterID returns up to limit applied staking operations with
+	// an id greater than afterID and a level up to maxLevel, ordered by id.
+	FetchStakingAfterID(ctx context.Context, afterID, maxLevel int64, limit int) ([]StakingOperation, error)
 }
 
+// maxRetryAfter is the longest Retry-After delay honoured within a call. A
+// longer delay fails the call and leaves the wait to the caller's backoff.
+const maxRetryAfter = time.Minute
+
 type client struct {
-	baseURL string
-	http    *http.Client
-	limiter *rate.Limiter
+	// endpoints are the TzKT instances requests are routed to.
+	endpoints *Endpoints
+	http      *http.Client
+	limiter   *Limiter
+	// breaker, when set, fails calls fast while TzKT keeps failing.
+	breaker *Breaker
+	// retryBackoff is the base delay between retries, doubled on each attempt.
+	retryBackoff time.Duration
+}
+
+// Option configures optional features of the TzKT client.
+type Option func(*client)
+
+// WithLimiter throttles requests with l instead of the default 10 requests
+// per second. The limiter may be shared with the health and metrics endpoints
+// to report the current rate.
+func WithLimiter(l *Limiter) Option {
+	return func(c *client) {
+		c.limiter = l
+	}
+}
+
+// WithTransport sends requests through rt, e.g. a fixture recorder or
+// replayer, instead of the default pooled transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *client) {
+		c.http.Transport = rt
+	}
 }
 
-func NewClient(baseURL string, timeout time.Duration) Client {
+// WithBreaker wraps every call in the circuit breaker b. The breaker may be
+// shared with a health check to report the state of the upstream.
+func WithBreaker(b *Breaker) Option {
+	return func(c *client) {
+		c.breaker = b
+	}
+}
+
+// WithEndpoints routes requests to the healthiest instance of e instead of
+// the base URL passed to NewClient. The pool may be shared with a health check
+// to report the instance in use.
+func WithEndpoints(e *Endpoints) Option {
+	return func(c *client) {
+		c.endpoints = e
+	}
+}
+
+func NewClient(baseURL string, timeout time.Duration, opts ...Option) Client {
 	if baseURL == "" {
 		baseURL = "https://api.tzkt.io/v1"
 	}
-	return &client{
-		baseURL: baseURL,
+	c := &client{
+		endpoints: NewEndpoints(baseURL),
 		http: &http.Client{
 			Timeout: timeout,
 			Transport: &http.Transport{
@@ -41,86 +117,480 @@ func NewClient(baseURL string, timeout time.Duration) Client {
 			},
 		},
 		// Rate limit: 10 requests per second with burst of 5
-		limiter: rate.NewLimiter(rate.Limit(10), 5),
+		limiter:      NewLimiter(10, 5),
+		retryBackoff: time.Second,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Account is an address with its optional TzKT alias.
+type Account struct {
+	Alias   string `json:"alias"`
+	Address string `json:"address"`
+}
+
+// Block identifies the block TzKT currently has at a level.
+type Block struct {
+	Level     int64     `json:"level"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type Delegation struct {
 	ID        int64     `json:"id"`
 	Level     int64     `json:"level"`
+	Block     string    `json:"block"`
 	Timestamp time.Time `json:"timestamp"`
 	Amount    int64     `json:"amount"`
 	Sender    struct {
 		Address string `json:"address"`
 	} `json:"sender"`
+	// PrevDelegate is the baker the sender moved away from, nil for a first delegation.
+	PrevDelegate *Account `json:"prevDelegate"`
+	// NewDelegate is the baker the sender moved to, nil for an undelegation.
+	NewDelegate *Account `json:"newDelegate"`
+	// Status is applied, failed, backtracked or skipped.
+	Status string `json:"status"`
+	// Errors explains why a delegation that was not applied failed.
+	Errors []OperationError `json:"errors,omitempty"`
+}
+
+// OperationError is an error reported for a failed operation, e.g.
+// contract.manager.unregistered_delegate.
+type OperationError struct {
+	Type string `json:"type"`
 }
 
 func (c *client) FetchDelegations(ctx context.Context, since time.Time, limit int) ([]Delegation, error) {
-	if err := c.limiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter: %w", err)
+	q := url.Values{}
+	q.Set("timestamp.gt", since.UTC().Format(time.RFC3339))
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", limit))
+	return c.fetchDelegations(ctx, q)
+}
+
+func (c *client) FetchDelegationsAfterID(ctx context.Context, afterID int64, limit int) ([]Delegation, error) {
+	q := url.Values{}
+	q.Set("id.gt", fmt.Sprintf("%d", afterID))
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", limit))
+	return c.fetchDelegations(ctx, q)
+}
+
+func (c *client) FetchDelegationsAtLevel(ctx context.Context, level int64) ([]Delegation, error) {
+	q := url.Values{}
+	q.Set("level", fmt.Sprintf("%d", level))
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", maxLimit))
+	return c.fetchDelegations(ctx, q)
+}
+
+func (c *client) FetchDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit int) ([]Delegation, error) {
+	q := url.Values{}
+	q.Set("level.ge", fmt.Sprintf("%d", fromLevel))
+	q.Set("level.lt", fmt.Sprintf("%d", toLevel))
+	q.Set("id.gt", fmt.Sprintf("%d", afterID))
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", limit))
+	return c.fetchDelegations(ctx, q)
+}
+
+func (c *client) StreamDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit, chunkSize int, handle func([]Delegation) error) (int, error) {
+	q := url.Values{}
+	q.Set("level.ge", fmt.Sprintf("%d", fromLevel))
+	q.Set("level.lt", fmt.Sprintf("%d", toLevel))
+	q.Set("id.gt", fmt.Sprintf("%d", afterID))
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", limit))
+
+	var (
+		n    int
+		last Delegation
+	)
+	err := c.getDelegations(ctx, q, func(r io.Reader) error {
+		var handleErr, err error
+		n, err = decodeDelegations(r, chunkSize, func(chunk []Delegation) error {
+			if handleErr = handle(chunk); handleErr != nil {
+				return handleErr
+			}
+			last = chunk[len(chunk)-1]
+			return nil
+		})
+		if err != nil && handleErr == nil && last.ID != 0 {
+			// Chunks were handled already: resending the request to another
+			// instance would hand them to handle again.
+			return fmt.Errorf("%w: %w", errStreamInterrupted, err)
+		}
+		return err
+	}, &last)
+	return n, err
+}
+
+// errStreamInterrupted marks a streamed response that broke off after some of
+// its chunks were handled. It is not failed over to another instance.
+var errStreamInterrupted = errors.New("tzkt: stream interrupted")
+
+func (c *client) CountDelegationsInRange(ctx context.Context, fromLevel, toLevel int64) (int, error) {
+	q := url.Values{}
+	q.Set("level.ge", fmt.Sprintf("%d", fromLevel))
+	q.Set("level.lt", fmt.Sprintf("%d", toLevel))
+
+	var n int
+	if err := c.get(ctx, "/operations/delegations/count", q, decodeInto(&n)); err != nil {
+		return 0, err
 	}
+	return n, nil
+}
 
-	u, err := url.Parse(c.baseURL + "/operations/delegations")
-	if err != nil {
-		return nil, fmt.Errorf("parse url: %w", err)
+func (c *client) FetchHead(ctx context.Context) (Block, error) {
+	var out Block
+	if err := c.get(ctx, "/head", url.Values{}, decodeInto(&out)); err != nil {
+		return Block{}, err
 	}
+	return out, nil
+}
 
-	q := u.Query()
-	q.Set("timestamp.gt", since.UTC().Format(time.RFC3339))
-	q.Set("sort.asc", "id")
+func (c *client) FetchBlocks(ctx context.Context, fromLevel int64, limit int) ([]Block, error) {
+	q := url.Values{}
+	q.Set("level.ge", fmt.Sprintf("%d", fromLevel))
+	q.Set("sort.asc", "level")
 	q.Set("limit", fmt.Sprintf("%d", limit))
-	q.Set("status", "applied")
-	u.RawQuery = q.Encode()
+	q.Set("select.fields", "level,hash,timestamp")
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	var out []Block
+	if err := c.get(ctx, "/blocks", q, decodeInto(&out)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *client) fetchDelegations(ctx context.Context, q url.Values) ([]Delegation, error) {
+	var (
+		out  []Delegation
+		last Delegation
+	)
+	err := c.getDelegations(ctx, q, func(r io.Reader) error {
+		if err := decodeInto(&out)(r); err != nil {
+			return err
+		}
+		if len(out) > 0 {
+			last = out[len(out)-1]
+		}
+		return nil
+	}, &last)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	// Retry with exponential backoff
-	var resp *http.Response
-	var lastErr error
-	maxRetries := 3
-	backoff := 1 * time.Second
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			select {
-			case <-time.After(backoff):
-				backoff *= 2 // Exponential backoff
-			case <-ctx.Done():
-				return nil, ctx.Err()
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeInto decodes a whole JSON response into out.
+func decodeInto(out any) func(io.Reader) error {
+	return func(r io.Reader) error {
+		if err := json.NewDecoder(r).Decode(out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	}
+}
+
+// decodeDelegations reads a JSON array of delegations one element at a time,
+// passing them to handle in chunks of at most size. It returns the number of
+// delegations read.
+func decodeDelegations(r io.Reader, size int, handle func([]Delegation) error) (int, error) {
+	if size <= 0 {
+		size = maxLimit
+	}
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '['); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	chunk := make([]Delegation, 0, size)
+	for dec.More() {
+		// Appending a zero value clears whatever a previous chunk left in the slot.
+		chunk = append(chunk, Delegation{})
+		if err := dec.Decode(&chunk[len(chunk)-1]); err != nil {
+			return n, fmt.Errorf("decode delegation %d: %w", n, err)
+		}
+		n++
+		if len(chunk) == size {
+			if err := handle(chunk); err != nil {
+				return n, err
 			}
+			chunk = chunk[:0]
+		}
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return n, err
+	}
+	if len(chunk) > 0 {
+		if err := handle(chunk); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("decode response: expected %s, got %v", want, tok)
+	}
+	return nil
+}
+
+// get performs a rate limited GET request against the TzKT API and passes
+// the response body to decode. Network errors, 429 and 502/503/504 responses
+// are retried, waiting as long as Retry-After asks or else with jittered
+// exponential backoff, and then tried on the other instances of the pool.
+// Calls fail fast with ErrCircuitOpen while the breaker is open. Only
+// failures before the body is read are retried, so decode sees the body of a
+// single response.
+func (c *client) get(ctx context.Context, path string, q url.Values, decode func(io.Reader) error) error {
+	return c.call(ctx, path, q, decode, nil)
+}
+
+// getDelegations is get for delegations. decode sets last to the last
+// delegation it read, which anchors the instances of the pool to each other.
+func (c *client) getDelegations(ctx context.Context, q url.Values, decode func(io.Reader) error, last *Delegation) error {
+	return c.call(ctx, "/operations/delegations", q, decode, last)
+}
+
+func (c *client) call(ctx context.Context, path string, q url.Values, decode func(io.Reader) error, last *Delegation) error {
+	if c.breaker != nil {
+		if err := c.breaker.Allow(); err != nil {
+			return err
+		}
+	}
+
+	err := c.failover(ctx, path, q, decode, last)
+	if c.breaker != nil {
+		var upstream *upstreamError
+		switch {
+		case err == nil:
+			c.breaker.Success()
+		case errors.As(err, &upstream):
+			c.breaker.Failure()
+		case ctx.Err() != nil:
+			// Cancelled by the caller: says nothing about TzKT. Release the
+			// trial slot of a half-open breaker without changing its state.
+			c.breaker.Release()
+		default:
+			// TzKT answered, e.g. with a client error or an undecodable body,
+			// or the caller failed to handle a streamed chunk. A body that
+			// breaks off is an upstreamError.
+			c.breaker.Success()
+		}
+	}
+	return err
+}
+
+// failover sends the request to the instance picked by the pool, and to the
+// next healthiest one for as long as instances fail. An instance other than
+// the one that served the last delegation is checked against it first.
+func (c *client) failover(ctx context.Context, path string, q url.Values, decode func(io.Reader) error, last *Delegation) error {
+	tried := make(map[*endpoint]bool)
+	var err error
+	for {
+		ep := c.endpoints.pick(tried)
+		if ep == nil {
+			return err
 		}
+		tried[ep] = true
 
-		resp, lastErr = c.http.Do(req)
-		if lastErr != nil {
-			continue // Retry on network error
+		if anchor := c.endpoints.needsCheck(ep); anchor != nil {
+			if err = c.checkAnchor(ctx, ep, *anchor); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				continue
+			}
 		}
+		c.endpoints.use(ep)
 
-		if resp.StatusCode == http.StatusTooManyRequests {
-			err := resp.Body.Close()
-			if err != nil {
-				return nil, err
+		err = c.do(ctx, ep, path, q, decode)
+		var upstream *upstreamError
+		if errors.As(err, &upstream) {
+			c.endpoints.failure(ep)
+			if ctx.Err() != nil || errors.Is(err, errStreamInterrupted) {
+				return err
 			}
 			continue
 		}
+		c.endpoints.success(ep)
+		if err == nil && last != nil && last.ID != 0 {
+			c.endpoints.served(ep, *last)
+		}
+		return err
+	}
+}
 
-		break
+// checkAnchor verifies that ep has the anchor delegation at the same level of
+// the same block, i.e. that ep numbers operations like the instance that
+// served it. ep is avoided when it does not.
+func (c *client) checkAnchor(ctx context.Context, ep *endpoint, anchor Delegation) error {
+	q := url.Values{}
+	q.Set("id", strconv.FormatInt(anchor.ID, 10))
+	var found []Delegation
+	err := c.do(ctx, ep, "/operations/delegations", q, decodeInto(&found))
+	var upstream *upstreamError
+	switch {
+	case errors.As(err, &upstream):
+		c.endpoints.failure(ep)
+		return err
+	case err != nil:
+		c.endpoints.diverge(ep)
+		return fmt.Errorf("tzkt: check %s: %w", ep.url, err)
+	case len(found) == 0 && c.endpoints.behind(ep, anchor.Level):
+		// Not indexed yet: the instance lags rather than diverges.
+		c.endpoints.failure(ep)
+		return &upstreamError{fmt.Errorf("tzkt: %s is behind level %d", ep.url, anchor.Level)}
+	case len(found) == 0 || found[0].Level != anchor.Level || found[0].Block != anchor.Block:
+		c.endpoints.diverge(ep)
+		return &upstreamError{fmt.Errorf("tzkt: %s diverges at delegation %d", ep.url, anchor.ID)}
 	}
+	return nil
+}
+
+// upstreamError is a failure of TzKT itself: the request could not be made,
+// TzKT answered with a server error or kept rate limiting, or the response
+// body could not be read to the end.
+type upstreamError struct {
+	err error
+}
+
+func (e *upstreamError) Error() string { return e.err.Error() }
+func (e *upstreamError) Unwrap() error { return e.err }
 
-	if lastErr != nil {
-		return nil, fmt.Errorf("http request failed after %d attempts: %w", maxRetries, lastErr)
+func (c *client) do(ctx context.Context, ep *endpoint, path string, q url.Values, decode func(io.Reader) error) error {
+	u, err := url.Parse(ep.url + path)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("tzkt: unexpected status %d", resp.StatusCode)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
 	}
 
-	var out []Delegation
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	const maxAttempts = 3
+	backoff := c.retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+
+		resp, err := c.http.Do(req)
+		if err == nil {
+			c.limiter.observe(resp, time.Now())
+			c.endpoints.observe(ep, resp.Header)
+		}
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			err = &upstreamError{fmt.Errorf("http request failed: %w", err)}
+			wait = jitter(backoff)
+		case retryable(resp.StatusCode):
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = &upstreamError{fmt.Errorf("tzkt: unexpected status %d", resp.StatusCode)}
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if d > maxRetryAfter {
+					return &upstreamError{fmt.Errorf("tzkt: status %d, retry after %s", resp.StatusCode, d)}
+				}
+				wait = d
+			} else {
+				wait = jitter(backoff)
+			}
+		default:
+			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				return fmt.Errorf("tzkt: unexpected status %d", resp.StatusCode)
+			}
+			body := &bodyReader{r: resp.Body}
+			err := decode(body)
+			if err != nil && body.err != nil && ctx.Err() == nil {
+				return &upstreamError{fmt.Errorf("read response: %w", err)}
+			}
+			return err
+		}
+
+		if attempt == maxAttempts {
+			return fmt.Errorf("after %d attempts: %w", maxAttempts, err)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
 	}
-	return out, nil
+}
+
+// bodyReader records the first error reading a response body, other than
+// io.EOF, so that a connection dropped mid-body is told apart from a body
+// that does not decode.
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// jitter returns a random delay between half and all of d, so that clients
+// failing together do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
 }
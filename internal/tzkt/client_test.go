@@ -2,8 +2,10 @@ package tzkt
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,7 +17,7 @@ func TestFetchDelegations_OK(t *testing.T) {
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, "/operations/delegations", r.URL.Path)
-		require.Equal(t, "applied", r.URL.Query().Get("status"))
+		require.False(t, r.URL.Query().Has("status"), "every status is fetched")
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(`[
 			{
@@ -23,7 +25,17 @@ func TestFetchDelegations_OK(t *testing.T) {
 				"level": 100,
 				"timestamp": "` + now.Format(time.RFC3339) + `",
 				"amount": 12345,
-				"sender": { "address": "tz1abc" }
+				"sender": { "address": "tz1abc" },
+				"status": "applied"
+			},
+			{
+				"id": 2,
+				"level": 101,
+				"timestamp": "` + now.Format(time.RFC3339) + `",
+				"amount": 0,
+				"sender": { "address": "tz1def" },
+				"status": "failed",
+				"errors": [ { "type": "contract.manager.unregistered_delegate" } ]
 			}
 		]`))
 	}))
@@ -32,8 +44,349 @@ func TestFetchDelegations_OK(t *testing.T) {
 	c := NewClient(srv.URL, 2*time.Second)
 	res, err := c.FetchDelegations(context.Background(), now.Add(-time.Hour), 10)
 	require.NoError(t, err)
-	require.Len(t, res, 1)
+	require.Len(t, res, 2)
 	require.Equal(t, int64(1), res[0].ID)
 	require.Equal(t, int64(12345), res[0].Amount)
 	require.Equal(t, "tz1abc", res[0].Sender.Address)
+	require.Equal(t, "applied", res[0].Status)
+	require.Empty(t, res[0].Errors)
+
+	require.Equal(t, "failed", res[1].Status)
+	require.Equal(t, []OperationError{{Type: "contract.manager.unregistered_delegate"}}, res[1].Errors)
+}
+
+func TestFetchDelegations_DecodesBakers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{
+				"id": 2,
+				"level": 200,
+				"timestamp": "2022-05-05T06:29:14Z",
+				"amount": 500,
+				"sender": { "address": "tz1abc" },
+				"prevDelegate": { "alias": "Old Baker", "address": "tz1old" },
+				"newDelegate": { "alias": "New Baker", "address": "tz1new" }
+			},
+			{
+				"id": 3,
+				"level": 201,
+				"timestamp": "2022-05-05T06:29:44Z",
+				"amount": 600,
+				"sender": { "address": "tz1def" },
+				"prevDelegate": { "address": "tz1new" }
+			}
+		]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	res, err := c.FetchDelegations(context.Background(), time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	require.NotNil(t, res[0].NewDelegate)
+	require.Equal(t, "tz1new", res[0].NewDelegate.Address)
+	require.Equal(t, "New Baker", res[0].NewDelegate.Alias)
+	require.NotNil(t, res[0].PrevDelegate)
+	require.Equal(t, "tz1old", res[0].PrevDelegate.Address)
+
+	require.Nil(t, res[1].NewDelegate, "undelegation has no new baker")
+	require.Equal(t, "tz1new", res[1].PrevDelegate.Address)
+	require.Empty(t, res[1].PrevDelegate.Alias)
+}
+
+func TestFetchDelegationsAfterID_Query(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "42", q.Get("id.gt"))
+		require.Equal(t, "id", q.Get("sort.asc"))
+		require.Equal(t, "10", q.Get("limit"))
+		require.Empty(t, q.Get("timestamp.gt"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	res, err := c.FetchDelegationsAfterID(context.Background(), 42, 10)
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
+
+func TestFetchDelegationsAtLevel_Query(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "500", q.Get("level"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id": 7, "level": 500, "sender": {"address": "tz1abc"}}]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	res, err := c.FetchDelegationsAtLevel(context.Background(), 500)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, int64(500), res[0].Level)
+}
+
+func TestFetchBlocks_OK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/blocks", r.URL.Path)
+		q := r.URL.Query()
+		require.Equal(t, "100", q.Get("level.ge"))
+		require.Equal(t, "level", q.Get("sort.asc"))
+		require.Equal(t, "2", q.Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"level": 100, "hash": "BLockA", "timestamp": "2024-01-01T00:00:00Z"},
+			{"level": 101, "hash": "BLockB", "timestamp": "2024-01-01T00:00:08Z"}
+		]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	res, err := c.FetchBlocks(context.Background(), 100, 2)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, int64(101), res[1].Level)
+	require.Equal(t, "BLockB", res[1].Hash)
+}
+
+func TestFetchDelegationsInRange_Query(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "100", q.Get("level.ge"))
+		require.Equal(t, "200", q.Get("level.lt"))
+		require.Equal(t, "7", q.Get("id.gt"))
+		require.Equal(t, "id", q.Get("sort.asc"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	_, err := c.FetchDelegationsInRange(context.Background(), 100, 200, 7, 10)
+	require.NoError(t, err)
+}
+
+func TestStreamDelegationsInRange_Chunks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "100", q.Get("level.ge"))
+		require.Equal(t, "200", q.Get("level.lt"))
+		require.Equal(t, "7", q.Get("id.gt"))
+		require.Equal(t, "5", q.Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"id": 8, "level": 100, "sender": {"address": "tz1a"}, "newDelegate": {"address": "tz1baker"}},
+			{"id": 9, "level": 101, "sender": {"address": "tz1b"}, "newDelegate": {"address": "tz1baker"}},
+			{"id": 10, "level": 102, "sender": {"address": "tz1c"}},
+			{"id": 11, "level": 150, "sender": {"address": "tz1d"}},
+			{"id": 12, "level": 199, "sender": {"address": "tz1e"}}
+		]`))
+	}))
+	defer srv.Close()
+
+	var chunks [][]int64
+	c := NewClient(srv.URL, 2*time.Second)
+	n, err := c.StreamDelegationsInRange(context.Background(), 100, 200, 7, 5, 2, func(chunk []Delegation) error {
+		var ids []int64
+		for _, d := range chunk {
+			ids = append(ids, d.ID)
+			if d.ID == 10 {
+				// The slot reused from the previous chunk must not keep its baker.
+				require.Nil(t, d.NewDelegate)
+			}
+		}
+		chunks = append(chunks, ids)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, [][]int64{{8, 9}, {10, 11}, {12}}, chunks)
+}
+
+func TestStreamDelegationsInRange_StopsOnHandlerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+	}))
+	defer srv.Close()
+
+	calls := 0
+	failed := errors.New("store unavailable")
+	breaker := NewBreaker(1, time.Minute)
+	c := NewClient(srv.URL, 2*time.Second, WithBreaker(breaker))
+	n, err := c.StreamDelegationsInRange(context.Background(), 0, 10, 0, 10, 1, func([]Delegation) error {
+		calls++
+		if calls == 2 {
+			return failed
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, failed)
+	require.Equal(t, 2, calls)
+	require.Equal(t, 2, n)
+	require.Equal(t, BreakerClosed, breaker.State(), "TzKT answered fine")
+}
+
+func TestStreamDelegationsInRange_BrokenBodyIsAFailure(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// Promise more than is sent, as a connection dropped mid-body does.
+		w.Header().Set("Content-Length", "1000")
+		_, _ = w.Write([]byte(`[{"id": 1}, {"id": 2}, {"id"`))
+	}))
+	defer srv.Close()
+
+	var handled []int64
+	breaker := NewBreaker(1, time.Minute)
+	endpoints := NewEndpoints(srv.URL, srv.URL)
+	c := NewClient("", 2*time.Second, WithBreaker(breaker), WithEndpoints(endpoints))
+	_, err := c.StreamDelegationsInRange(context.Background(), 0, 10, 0, 10, 1, func(chunk []Delegation) error {
+		handled = append(handled, chunk[0].ID)
+		return nil
+	})
+	var upstream *upstreamError
+	require.ErrorAs(t, err, &upstream)
+	require.Equal(t, BreakerOpen, breaker.State())
+	require.Equal(t, []int64{1, 2}, handled, "handled chunks are not sent again")
+	require.Equal(t, 1, requests)
+	require.Equal(t, 1, endpoints.Status()[0].Failures)
+}
+
+func TestDecodeDelegations_RejectsNonArray(t *testing.T) {
+	_, err := decodeDelegations(strings.NewReader(`{"id": 1}`), 10, func([]Delegation) error { return nil })
+	require.Error(t, err)
+
+	_, err = decodeDelegations(strings.NewReader(`[{"id": 1}, {"id": "x"}]`), 10, func([]Delegation) error { return nil })
+	require.ErrorContains(t, err, "decode delegation 1")
+}
+
+func TestCountDelegationsInRange_Query(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/operations/delegations/count", r.URL.Path)
+		require.Equal(t, "level.ge=100&level.lt=200", r.URL.RawQuery)
+		_, _ = w.Write([]byte(`42`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	n, err := c.CountDelegationsInRange(context.Background(), 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, 42, n)
+}
+
+func TestFetchHead_OK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/head", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"chain": "mainnet", "level": 5000000, "hash": "BLhead", "timestamp": "2024-01-01T00:00:00Z"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	head, err := c.FetchHead(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(5000000), head.Level)
+	require.Equal(t, "BLhead", head.Hash)
+}
+
+func TestGet_RetriesServerErrorsAndHonoursRetryAfter(t *testing.T) {
+	var calls []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+		switch len(calls) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"level": 42, "hash": "BLhead"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second).(*client)
+	c.retryBackoff = time.Millisecond
+
+	head, err := c.FetchHead(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(42), head.Level)
+	require.Len(t, calls, 3)
+	require.GreaterOrEqual(t, calls[2].Sub(calls[1]), time.Second, "waits as long as Retry-After asks")
+}
+
+func TestGet_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second).(*client)
+	c.retryBackoff = time.Millisecond
+
+	_, err := c.FetchHead(context.Background())
+	require.ErrorContains(t, err, "unexpected status 400")
+	require.Equal(t, 1, calls)
+}
+
+func TestGet_GivesUpOnLongRetryAfter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, 2*time.Second).FetchHead(context.Background())
+	require.ErrorContains(t, err, "retry after 1h0m0s")
+	require.Equal(t, 1, calls)
+}
+
+func TestGet_BreakerOpensOnRepeatedFailures(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	breaker := NewBreaker(2, time.Minute)
+	c := NewClient(srv.URL, 2*time.Second, WithBreaker(breaker)).(*client)
+	c.retryBackoff = time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		_, err := c.FetchHead(context.Background())
+		require.ErrorContains(t, err, "unexpected status 503")
+	}
+	require.Equal(t, BreakerOpen, breaker.State())
+	require.Equal(t, 6, calls)
+
+	_, err := c.FetchHead(context.Background())
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, 6, calls, "an open breaker does not call TzKT")
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d, ok := retryAfter("5", now)
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, d)
+
+	d, ok = retryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Second, d)
+
+	_, ok = retryAfter("", now)
+	require.False(t, ok)
+	_, ok = retryAfter("soon", now)
+	require.False(t, ok)
 }
@@ -0,0 +1,272 @@
+package tzkt
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of an endpoint pool.
+const (
+	// endpointCooldown is how long a failed instance is avoided, doubled on
+	// every consecutive failure up to maxEndpointCooldown.
+	endpointCooldown    = 30 * time.Second
+	maxEndpointCooldown = 10 * time.Minute
+	// maxEndpointLag is how many levels an instance may be behind the most
+	// advanced instance seen before it is considered stale.
+	maxEndpointLag = 10
+	// staleAfter is how long an instance may report the same level before it
+	// is considered stale. Blocks are produced every few seconds.
+	staleAfter = 2 * time.Minute
+)
+
+// Endpoints is an ordered pool of TzKT instances indexing the same network.
+// A client sticks to one instance while it is healthy, and fails over to the
+// healthiest other one when it fails or serves stale data, preferring the
+// earlier instances of the pool on ties.
+//
+// Operation ids are the cursor of every poller, so an instance is only used
+// once it agrees with the previous one on the last delegation served: the
+// same id must be at the same level of the same block. Switching instances
+// then never skips or duplicates operations.
+type Endpoints struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	list    []*endpoint
+	current *endpoint
+	// anchor is the last delegation served, with the instance it came from.
+	anchor     *Delegation
+	anchoredOn *endpoint
+}
+
+type endpoint struct {
+	url string
+	// failures counts consecutive failed calls; the instance is avoided until downUntil.
+	failures  int
+	downUntil time.Time
+	// level is the last level the instance reported indexing, first seen at levelAt.
+	level   int64
+	levelAt time.Time
+	// diverged is set when the instance disagreed with the anchor.
+	diverged bool
+}
+
+// EndpointStatus is the health of an instance of the pool.
+type EndpointStatus struct {
+	URL      string
+	Current  bool
+	Healthy  bool
+	Level    int64
+	Failures int
+	// Reason explains why an unhealthy instance is avoided.
+	Reason string
+}
+
+// NewEndpoints returns a pool of the given base URLs, in order of preference.
+func NewEndpoints(urls ...string) *Endpoints {
+	e := &Endpoints{now: time.Now}
+	for _, u := range urls {
+		e.list = append(e.list, &endpoint{url: u})
+	}
+	if len(e.list) > 0 {
+		e.current = e.list[0]
+	}
+	return e
+}
+
+// Current returns the base URL requests are currently sent to.
+func (e *Endpoints) Current() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.current.url
+}
+
+// Status reports the health of every instance, in order of preference.
+func (e *Endpoints) Status() []EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	best := e.bestLevel()
+	out := make([]EndpointStatus, 0, len(e.list))
+	for _, ep := range e.list {
+		reason := e.unhealthy(ep, now, best)
+		out = append(out, EndpointStatus{
+			URL:      ep.url,
+			Current:  ep == e.current,
+			Healthy:  reason == "",
+			Level:    ep.level,
+			Failures: ep.failures,
+			Reason:   reason,
+		})
+	}
+	return out
+}
+
+// pick returns the instance to send the next request to, skipping those in
+// tried. It keeps the current instance while it is healthy, and otherwise
+// returns the healthiest one, preferring the current instance and then the
+// order of the pool on ties. Unhealthy instances are still returned so that
+// requests go out; pick returns nil once every instance was tried.
+func (e *Endpoints) pick(tried map[*endpoint]bool) *endpoint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	best := e.bestLevel()
+	if !tried[e.current] && e.unhealthy(e.current, now, best) == "" {
+		return e.current
+	}
+
+	var pick *endpoint
+	pickScore := 0
+	for _, ep := range e.list {
+		if tried[ep] {
+			continue
+		}
+		score := e.score(ep, now, best)
+		if pick == nil || score < pickScore || score == pickScore && ep == e.current {
+			pick, pickScore = ep, score
+		}
+	}
+	return pick
+}
+
+// score ranks instances for failover, lowest first: healthy instances, then
+// stale ones, then those cooling down after failures, then those that
+// diverged.
+func (e *Endpoints) score(ep *endpoint, now time.Time, best int64) int {
+	switch {
+	case ep.diverged && now.Before(ep.downUntil):
+		return 3
+	case now.Before(ep.downUntil):
+		return 2
+	case e.stale(ep, now, best):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// unhealthy returns why ep should be avoided, or "" if it is healthy.
+func (e *Endpoints) unhealthy(ep *endpoint, now time.Time, best int64) string {
+	switch {
+	case ep.diverged && now.Before(ep.downUntil):
+		return "diverged from the last delegation served"
+	case now.Before(ep.downUntil):
+		return fmt.Sprintf("%d consecutive failures", ep.failures)
+	case e.stale(ep, now, best):
+		return fmt.Sprintf("stale at level %d", ep.level)
+	default:
+		return ""
+	}
+}
+
+func (e *Endpoints) stale(ep *endpoint, now time.Time, best int64) bool {
+	if ep.level == 0 {
+		// Nothing reported yet.
+		return false
+	}
+	return best-ep.level > maxEndpointLag || now.Sub(ep.levelAt) > staleAfter
+}
+
+// bestLevel is the highest level reported by any instance.
+func (e *Endpoints) bestLevel() int64 {
+	var best int64
+	for _, ep := range e.list {
+		best = max(best, ep.level)
+	}
+	return best
+}
+
+// needsCheck returns the anchor ep must agree with before it is used, or nil
+// when ep served the anchor itself or nothing was served yet.
+func (e *Endpoints) needsCheck(ep *endpoint) *Delegation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.anchor == nil || e.anchoredOn == ep {
+		return nil
+	}
+	anchor := *e.anchor
+	return &anchor
+}
+
+// use makes ep the current instance once it is known to agree with the anchor.
+func (e *Endpoints) use(ep *endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.current = ep
+	ep.diverged = false
+	if e.anchor != nil {
+		e.anchoredOn = ep
+	}
+}
+
+// served records the last delegation of a response from ep as the anchor.
+func (e *Endpoints) served(ep *endpoint, d Delegation) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.anchor != nil && e.anchor.ID > d.ID {
+		// Backfill ranges are served out of order: keep the latest delegation.
+		return
+	}
+	e.anchor = &d
+	e.anchoredOn = ep
+}
+
+// behind reports whether ep has not reported indexing level yet.
+func (e *Endpoints) behind(ep *endpoint, level int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return ep.level < level
+}
+
+// observe records the level an instance reports in the Tzkt-Level header.
+func (e *Endpoints) observe(ep *endpoint, header http.Header) {
+	level, err := strconv.ParseInt(header.Get("Tzkt-Level"), 10, 64)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if level != ep.level {
+		ep.level = level
+		ep.levelAt = e.now()
+	}
+}
+
+// success records a call that ep answered.
+func (e *Endpoints) success(ep *endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ep.failures = 0
+	ep.downUntil = time.Time{}
+}
+
+// failure records a call that failed on ep, avoiding it for a cooldown that
+// grows with consecutive failures.
+func (e *Endpoints) failure(ep *endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ep.failures++
+	cooldown := endpointCooldown << min(ep.failures-1, 10)
+	ep.downUntil = e.now().Add(min(cooldown, maxEndpointCooldown))
+}
+
+// diverge avoids ep after it disagreed with the anchor.
+func (e *Endpoints) diverge(ep *endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ep.diverged = true
+	ep.downUntil = e.now().Add(maxEndpointCooldown)
+}
@@ -0,0 +1,153 @@
+package tzkt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEndpoints(now *time.Time, urls ...string) *Endpoints {
+	e := NewEndpoints(urls...)
+	e.now = func() time.Time { return *now }
+	return e
+}
+
+func levelHeader(level int64) http.Header {
+	return http.Header{"Tzkt-Level": []string{fmt.Sprint(level)}}
+}
+
+func TestEndpoints_SticksUntilFailure(t *testing.T) {
+	now := time.Now()
+	e := newTestEndpoints(&now, "a", "b")
+	a, b := e.list[0], e.list[1]
+
+	require.Equal(t, a, e.pick(nil))
+	e.failure(a)
+	require.Equal(t, b, e.pick(nil), "fails over to the next instance")
+	e.use(b)
+
+	now = now.Add(time.Hour)
+	require.Equal(t, b, e.pick(nil), "stays on the new instance once the first one recovers")
+	require.Equal(t, "b", e.Current())
+}
+
+func TestEndpoints_CooldownGrowsWithFailures(t *testing.T) {
+	now := time.Now()
+	e := newTestEndpoints(&now, "a")
+	a := e.list[0]
+
+	e.failure(a)
+	require.Equal(t, now.Add(endpointCooldown), a.downUntil)
+	e.failure(a)
+	require.Equal(t, now.Add(2*endpointCooldown), a.downUntil)
+	for range 10 {
+		e.failure(a)
+	}
+	require.Equal(t, now.Add(maxEndpointCooldown), a.downUntil)
+
+	require.Equal(t, a, e.pick(nil), "the only instance is still used while down")
+	require.Nil(t, e.pick(map[*endpoint]bool{a: true}))
+
+	e.success(a)
+	require.True(t, e.Status()[0].Healthy)
+}
+
+func TestEndpoints_AvoidsStaleInstances(t *testing.T) {
+	now := time.Now()
+	e := newTestEndpoints(&now, "a", "b", "c")
+	a, b, c := e.list[0], e.list[1], e.list[2]
+
+	e.observe(a, levelHeader(100))
+	e.observe(b, levelHeader(120))
+	require.Equal(t, b, e.pick(nil), "a lags b by more than the allowed levels")
+	e.use(b)
+
+	now = now.Add(staleAfter + time.Second)
+	e.observe(c, levelHeader(120))
+	require.Equal(t, c, e.pick(nil), "b has not advanced for too long")
+
+	status := e.Status()
+	require.Equal(t, "stale at level 100", status[0].Reason)
+	require.Equal(t, "stale at level 120", status[1].Reason)
+	require.True(t, status[1].Current)
+	require.True(t, status[2].Healthy)
+}
+
+func TestEndpoints_PrefersCurrentOnTies(t *testing.T) {
+	now := time.Now()
+	e := newTestEndpoints(&now, "a", "b")
+	a, b := e.list[0], e.list[1]
+
+	e.use(b)
+	e.failure(a)
+	e.failure(b)
+	require.Equal(t, b, e.pick(nil), "both are down: stay where the cursor is")
+}
+
+// delegationServer serves a single delegation and answers with 503 once fail is set.
+func delegationServer(t *testing.T, block string, fail *atomic.Bool, queries *[]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if queries != nil {
+			*queries = append(*queries, r.URL.RawQuery)
+		}
+		if fail != nil && fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Tzkt-Level", "110")
+		_, _ = fmt.Fprintf(w, `[{"id": 5, "level": 100, "block": %q, "sender": {"address": "tz1abc"}}]`, block)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient_FailsOverToAConsistentInstance(t *testing.T) {
+	var fail atomic.Bool
+	var queries []string
+	a := delegationServer(t, "BLa", &fail, nil)
+	b := delegationServer(t, "BLa", nil, &queries)
+
+	endpoints := NewEndpoints(a.URL, b.URL)
+	c := NewClient("", 2*time.Second, WithEndpoints(endpoints)).(*client)
+	c.retryBackoff = time.Millisecond
+
+	_, err := c.FetchDelegationsAfterID(context.Background(), 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, a.URL, endpoints.Current())
+	require.Empty(t, queries)
+
+	fail.Store(true)
+	res, err := c.FetchDelegationsAfterID(context.Background(), 5, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, b.URL, endpoints.Current())
+	require.Len(t, queries, 2)
+	require.Equal(t, "id=5", queries[0], "checks the last delegation served before switching")
+	require.True(t, strings.HasPrefix(queries[1], "id.gt=5"), queries[1])
+}
+
+func TestClient_AvoidsDivergingInstances(t *testing.T) {
+	var fail atomic.Bool
+	a := delegationServer(t, "BLa", &fail, nil)
+	b := delegationServer(t, "BLb", nil, nil)
+
+	endpoints := NewEndpoints(a.URL, b.URL)
+	c := NewClient("", 2*time.Second, WithEndpoints(endpoints)).(*client)
+	c.retryBackoff = time.Millisecond
+
+	_, err := c.FetchDelegationsAfterID(context.Background(), 0, 10)
+	require.NoError(t, err)
+
+	fail.Store(true)
+	_, err = c.FetchDelegationsAfterID(context.Background(), 5, 10)
+	require.ErrorContains(t, err, "diverges at delegation 5")
+	require.Equal(t, a.URL, endpoints.Current(), "the cursor stays on the instance that served it")
+	require.Equal(t, "diverged from the last delegation served", endpoints.Status()[1].Reason)
+}
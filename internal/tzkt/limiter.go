@@ -0,0 +1,102 @@
+package tzkt
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minAdaptiveRate is the floor of an adaptive limiter, so that it keeps
+// probing TzKT and can recover after a burst of rate limiting.
+const minAdaptiveRate = rate.Limit(0.1)
+
+// Limiter throttles the requests of a client. An adaptive limiter also
+// follows TzKT's feedback: it halves its rate on every 429, slows down to the
+// budget left in the X-RateLimit-Remaining and X-RateLimit-Reset headers, and
+// otherwise climbs back towards its configured rate.
+type Limiter struct {
+	limiter  *rate.Limiter
+	max      rate.Limit
+	adaptive bool
+
+	mu sync.Mutex
+}
+
+// NewLimiter returns a limiter allowing rps requests per second with bursts of burst.
+func NewLimiter(rps float64, burst int) *Limiter {
+	return &Limiter{limiter: rate.NewLimiter(rate.Limit(rps), burst), max: rate.Limit(rps)}
+}
+
+// NewAdaptiveLimiter returns a limiter that starts at, and never exceeds,
+// maxRPS requests per second and adapts to the rate-limit responses of TzKT.
+func NewAdaptiveLimiter(maxRPS float64, burst int) *Limiter {
+	l := NewLimiter(maxRPS, burst)
+	l.adaptive = true
+	return l
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
+
+// Rate returns the current rate in requests per second.
+func (l *Limiter) Rate() float64 {
+	return float64(l.limiter.Limit())
+}
+
+// Adaptive reports whether the limiter adapts its rate to TzKT's responses.
+func (l *Limiter) Adaptive() bool {
+	return l.adaptive
+}
+
+// observe adjusts an adaptive limiter to a response from TzKT.
+func (l *Limiter) observe(resp *http.Response, now time.Time) {
+	if !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.limiter.Limit()
+	next := current + l.max/10
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		next = current / 2
+	default:
+		if budget, ok := remainingBudget(resp.Header); ok {
+			next = min(next, budget)
+		}
+	}
+
+	if next > l.max {
+		next = l.max
+	}
+	if next < minAdaptiveRate {
+		next = minAdaptiveRate
+	}
+	if next != current {
+		l.limiter.SetLimitAt(now, next)
+	}
+}
+
+// remainingBudget returns the rate that spreads the requests remaining in the
+// current rate-limit window evenly until it resets.
+func remainingBudget(h http.Header) (rate.Limit, bool) {
+	remaining, err := strconv.ParseFloat(h.Get("X-RateLimit-Remaining"), 64)
+	if err != nil || remaining < 0 {
+		return 0, false
+	}
+	reset, err := strconv.ParseFloat(h.Get("X-RateLimit-Reset"), 64)
+	if err != nil || reset < 0 {
+		return 0, false
+	}
+	if reset < 1 {
+		reset = 1
+	}
+	return rate.Limit(remaining / reset), true
+}
@@ -0,0 +1,81 @@
+package tzkt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func limitResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestLimiter_FixedIgnoresResponses(t *testing.T) {
+	l := NewLimiter(20, 5)
+	l.observe(limitResponse(http.StatusTooManyRequests, nil), time.Now())
+	require.Equal(t, 20.0, l.Rate())
+	require.False(t, l.Adaptive())
+}
+
+func TestLimiter_AdaptiveHalvesOn429AndRecovers(t *testing.T) {
+	l := NewAdaptiveLimiter(20, 5)
+	now := time.Now()
+
+	l.observe(limitResponse(http.StatusTooManyRequests, nil), now)
+	require.Equal(t, 10.0, l.Rate())
+	l.observe(limitResponse(http.StatusTooManyRequests, nil), now)
+	require.Equal(t, 5.0, l.Rate())
+
+	for i := 0; i < 20; i++ {
+		l.observe(limitResponse(http.StatusOK, nil), now)
+	}
+	require.Equal(t, 20.0, l.Rate(), "climbs back to, but not above, the configured rate")
+}
+
+func TestLimiter_AdaptiveFollowsRateLimitHeaders(t *testing.T) {
+	l := NewAdaptiveLimiter(20, 5)
+	now := time.Now()
+
+	// 30 requests left for the next 10 seconds.
+	l.observe(limitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "30",
+		"X-RateLimit-Reset":     "10",
+	}), now)
+	require.Equal(t, 3.0, l.Rate())
+
+	// A larger budget is approached gradually.
+	l.observe(limitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "1000",
+		"X-RateLimit-Reset":     "10",
+	}), now)
+	require.Equal(t, 5.0, l.Rate())
+
+	// An exhausted budget slows down to the floor, never to a halt.
+	l.observe(limitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "10",
+	}), now)
+	require.Equal(t, float64(minAdaptiveRate), l.Rate())
+}
+
+func TestClient_AdaptsLimiterToResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "50")
+		w.Header().Set("X-RateLimit-Reset", "10")
+		_, _ = w.Write([]byte(`{"level": 1}`))
+	}))
+	defer srv.Close()
+
+	l := NewAdaptiveLimiter(10, 5)
+	_, err := NewClient(srv.URL, 2*time.Second, WithLimiter(l)).FetchHead(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5.0, l.Rate())
+}
@@ -0,0 +1,410 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// NodeIDStride spaces the synthetic ids of node delegations: the id of a
+// delegation is its level times NodeIDStride plus its position in the block,
+// so ids grow with the chain like TzKT ids do. They are not TzKT ids, so a
+// database must not switch between sources once it holds data.
+const NodeIDStride = 1_000_000
+
+// managerPass is the validation pass holding manager operations, which
+// include delegations.
+const managerPass = 3
+
+// rescanDepth is how many of the last scanned levels a resumed scan reads
+// again, so that blocks replaced by a reorganization are not skipped.
+const rescanDepth = 10
+
+var errNotFound = errors.New("not found")
+
+type nodeClient struct {
+	rpcURL  string
+	http    *http.Client
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+	// scanned remembers, per scan, the last level already scanned without
+	// reaching the limit, so repeated polls at the head resume from there
+	// instead of rescanning every block since the last delegation.
+	scanned map[scanKey]int64
+}
+
+type scanKey struct {
+	fromLevel int64
+	afterID   int64
+}
+
+// NewNodeClient returns a Client that reads delegations from the block RPC of
+// a Tezos node at rpcURL instead of TzKT. Delegations are returned without
+// aliases and with synthetic ids (see NodeIDStride).
+func NewNodeClient(rpcURL string, timeout time.Duration) Client {
+	if rpcURL == "" {
+		rpcURL = "http://localhost:8732"
+	}
+	return &nodeClient{
+		rpcURL: strings.TrimSuffix(rpcURL, "/"),
+		http: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 100,
+				IdleConnTimeout:     90 * time.Second,
+				DialContext: (&net.Dialer{
+					Timeout:   5 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+			},
+		},
+		// A node is usually private, so allow far more than the public TzKT API.
+		limiter: rate.NewLimiter(rate.Limit(100), 20),
+		scanned: make(map[scanKey]int64),
+	}
+}
+
+type nodeBlock struct {
+	Hash   string     `json:"hash"`
+	Header nodeHeader `json:"header"`
+	// Operations holds one list of operations per validation pass.
+	Operations [][]nodeOperation `json:"operations"`
+}
+
+type nodeHeader struct {
+	Hash      string    `json:"hash"`
+	Level     int64     `json:"level"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type nodeOperation struct {
+	Hash     string        `json:"hash"`
+	Contents []nodeContent `json:"contents"`
+}
+
+type nodeContent struct {
+	Kind     string  `json:"kind"`
+	Source   string  `json:"source"`
+	Delegate *string `json:"delegate"`
+	Metadata struct {
+		OperationResult          nodeResult `json:"operation_result"`
+		InternalOperationResults []struct {
+			Kind     string     `json:"kind"`
+			Source   string     `json:"source"`
+			Delegate *string    `json:"delegate"`
+			Result   nodeResult `json:"result"`
+		} `json:"internal_operation_results"`
+	} `json:"metadata"`
+}
+
+type nodeResult struct {
+	Status string `json:"status"`
+	Errors []struct {
+		ID string `json:"id"`
+	} `json:"errors"`
+}
+
+// operationErrors converts node error ids such as
+// proto.019-PtParisB.contract.manager.unregistered_delegate to the
+// protocol-independent types TzKT reports.
+func (r nodeResult) operationErrors() []OperationError {
+	var out []OperationError
+	for _, e := range r.Errors {
+		typ := e.ID
+		if rest, ok := strings.CutPrefix(typ, "proto."); ok {
+			if _, after, ok := strings.Cut(rest, "."); ok {
+				typ = after
+			}
+		}
+		out = append(out, OperationError{Type: typ})
+	}
+	return out
+}
+
+func (c *nodeClient) FetchDelegations(ctx context.Context, since time.Time, limit int) ([]Delegation, error) {
+	head, err := c.FetchHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from, err := c.firstLevelAfter(ctx, since, head.Level)
+	if err != nil {
+		return nil, err
+	}
+	return c.scan(ctx, scanKey{fromLevel: from}, head.Level+1, limit)
+}
+
+func (c *nodeClient) FetchDelegationsAfterID(ctx context.Context, afterID int64, limit int) ([]Delegation, error) {
+	head, err := c.FetchHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.scan(ctx, scanKey{fromLevel: afterID / NodeIDStride, afterID: afterID}, head.Level+1, limit)
+}
+
+func (c *nodeClient) FetchDelegationsAtLevel(ctx context.Context, level int64) ([]Delegation, error) {
+	block, err := c.block(ctx, level)
+	if err != nil {
+		return nil, err
+	}
+	return c.delegations(ctx, block)
+}
+
+func (c *nodeClient) FetchDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit int) ([]Delegation, error) {
+	if lvl := afterID / NodeIDStride; lvl > fromLevel {
+		fromLevel = lvl
+	}
+	return c.scan(ctx, scanKey{fromLevel: fromLevel, afterID: afterID}, toLevel, limit)
+}
+
+// StreamDelegationsInRange scans the range like FetchDelegationsInRange and
+// hands the result to handle in chunks. The whole page of up to limit
+// delegations is built before the first chunk, so with the node source memory
+// is bounded by limit, not by chunkSize.
+func (c *nodeClient) StreamDelegationsInRange(ctx context.Context, fromLevel, toLevel, afterID int64, limit, chunkSize int, handle func([]Delegation) error) (int, error) {
+	delegations, err := c.FetchDelegationsInRange(ctx, fromLevel, toLevel, afterID, limit)
+	if err != nil {
+		return 0, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = len(delegations)
+	}
+	for start := 0; start < len(delegations); start += chunkSize {
+		end := min(start+chunkSize, len(delegations))
+		if err := handle(delegations[start:end]); err != nil {
+			return end, err
+		}
+	}
+	return len(delegations), nil
+}
+
+// FetchStakingAfterID is not supported: the node reports staking as calls to
+// the stake, unstake and finalize_unstake entrypoints of the sender itself,
+// which this client does not decode.
+func (c *nodeClient) FetchStakingAfterID(context.Context, int64, int64, int) ([]StakingOperation, error) {
+	return nil, fmt.Errorf("node: staking operations: %w", errors.ErrUnsupported)
+}
+
+// CountDelegationsInRange is not supported: the node has no index to count
+// from, and scanning the range would cost as much as fetching it.
+func (c *nodeClient) CountDelegationsInRange(context.Context, int64, int64) (int, error) {
+	return 0, fmt.Errorf("node: count delegations: %w", errors.ErrUnsupported)
+}
+
+func (c *nodeClient) FetchBlocks(ctx context.Context, fromLevel int64, limit int) ([]Block, error) {
+	head, err := c.FetchHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Block
+	for lvl := fromLevel; lvl <= head.Level && len(out) < limit; lvl++ {
+		if lvl < 1 {
+			continue
+		}
+		var h nodeHeader
+		if err := c.get(ctx, fmt.Sprintf("/chains/main/blocks/%d/header", lvl), &h); err != nil {
+			return nil, fmt.Errorf("block header %d: %w", lvl, err)
+		}
+		out = append(out, Block{Level: h.Level, Hash: h.Hash, Timestamp: h.Timestamp})
+	}
+	return out, nil
+}
+
+func (c *nodeClient) FetchHead(ctx context.Context) (Block, error) {
+	var h nodeHeader
+	if err := c.get(ctx, "/chains/main/blocks/head/header", &h); err != nil {
+		return Block{}, fmt.Errorf("head header: %w", err)
+	}
+	return Block{Level: h.Level, Hash: h.Hash, Timestamp: h.Timestamp}, nil
+}
+
+// scan reads blocks from key.fromLevel up to, but excluding, toLevel and
+// returns up to limit delegations with an id greater than key.afterID.
+func (c *nodeClient) scan(ctx context.Context, key scanKey, toLevel int64, limit int) ([]Delegation, error) {
+	from := key.fromLevel
+	c.mu.Lock()
+	if lvl, ok := c.scanned[key]; ok && lvl-rescanDepth >= from {
+		from = lvl - rescanDepth + 1
+	}
+	c.mu.Unlock()
+	if from < 1 {
+		from = 1
+	}
+
+	var out []Delegation
+	for lvl := from; lvl < toLevel; lvl++ {
+		block, err := c.block(ctx, lvl)
+		if err != nil {
+			return nil, err
+		}
+		delegations, err := c.delegations(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range delegations {
+			if d.ID > key.afterID {
+				out = append(out, d)
+			}
+		}
+		if len(out) >= limit {
+			c.mu.Lock()
+			delete(c.scanned, key)
+			c.mu.Unlock()
+			return out[:limit], nil
+		}
+		if len(out) == 0 {
+			c.mu.Lock()
+			c.scanned[key] = lvl
+			c.mu.Unlock()
+		}
+	}
+	if len(out) > 0 {
+		c.mu.Lock()
+		delete(c.scanned, key)
+		c.mu.Unlock()
+	}
+	return out, nil
+}
+
+// firstLevelAfter binary searches the first level whose timestamp is after since.
+func (c *nodeClient) firstLevelAfter(ctx context.Context, since time.Time, head int64) (int64, error) {
+	lo, hi := int64(1), head+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		var h nodeHeader
+		if err := c.get(ctx, fmt.Sprintf("/chains/main/blocks/%d/header", mid), &h); err != nil {
+			return 0, fmt.Errorf("block header %d: %w", mid, err)
+		}
+		if h.Timestamp.After(since) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+func (c *nodeClient) block(ctx context.Context, level int64) (nodeBlock, error) {
+	var b nodeBlock
+	if err := c.get(ctx, fmt.Sprintf("/chains/main/blocks/%d", level), &b); err != nil {
+		return nodeBlock{}, fmt.Errorf("block %d: %w", level, err)
+	}
+	return b, nil
+}
+
+// delegations extracts the delegations of a block, whatever their status,
+// including those emitted by smart contracts, in block order.
+func (c *nodeClient) delegations(ctx context.Context, b nodeBlock) ([]Delegation, error) {
+	if len(b.Operations) <= managerPass {
+		return nil, nil
+	}
+
+	var out []Delegation
+	position := int64(0)
+	add := func(source string, delegate *string, result nodeResult) error {
+		position++
+		d, err := c.delegation(ctx, b, position, source, delegate)
+		if err != nil {
+			return err
+		}
+		d.Status = result.Status
+		d.Errors = result.operationErrors()
+		out = append(out, d)
+		return nil
+	}
+
+	for _, op := range b.Operations[managerPass] {
+		for _, content := range op.Contents {
+			if content.Kind == "delegation" {
+				if err := add(content.Source, content.Delegate, content.Metadata.OperationResult); err != nil {
+					return nil, err
+				}
+			} else {
+				position++
+			}
+			for _, internal := range content.Metadata.InternalOperationResults {
+				if internal.Kind != "delegation" {
+					position++
+					continue
+				}
+				if err := add(internal.Source, internal.Delegate, internal.Result); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// delegation builds the record of a delegation by source, looking up the
+// balance it delegated and the baker it left from the node context.
+func (c *nodeClient) delegation(ctx context.Context, b nodeBlock, position int64, source string, delegate *string) (Delegation, error) {
+	level := b.Header.Level
+	d := Delegation{
+		ID:        level*NodeIDStride + position,
+		Level:     level,
+		Block:     b.Hash,
+		Timestamp: b.Header.Timestamp,
+	}
+	d.Sender.Address = source
+	if delegate != nil {
+		d.NewDelegate = &Account{Address: *delegate}
+	}
+
+	var balance string
+	if err := c.get(ctx, fmt.Sprintf("/chains/main/blocks/%d/context/contracts/%s/balance", level, source), &balance); err != nil {
+		return Delegation{}, fmt.Errorf("balance of %s at level %d: %w", source, level, err)
+	}
+	if _, err := fmt.Sscanf(balance, "%d", &d.Amount); err != nil {
+		return Delegation{}, fmt.Errorf("parse balance %q of %s: %w", balance, source, err)
+	}
+
+	var prev string
+	err := c.get(ctx, fmt.Sprintf("/chains/main/blocks/%d/context/contracts/%s/delegate", level-1, source), &prev)
+	switch {
+	case errors.Is(err, errNotFound):
+	case err != nil:
+		return Delegation{}, fmt.Errorf("delegate of %s at level %d: %w", source, level-1, err)
+	default:
+		d.PrevDelegate = &Account{Address: prev}
+	}
+	return d, nil
+}
+
+// get performs a rate limited GET against the node RPC and decodes the JSON
+// response into out. It returns errNotFound for a 404.
+func (c *nodeClient) get(ctx context.Context, path string, out any) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.rpcURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("node: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
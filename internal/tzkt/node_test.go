@@ -0,0 +1,247 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	nodeDelegator = "tz1NewDelegatorxxxxxxxxxxxxxxxxxxxx"
+	nodeContract  = "KT1Contractxxxxxxxxxxxxxxxxxxxxxxxxx"
+	nodeBaker     = "tz1Bakerxxxxxxxxxxxxxxxxxxxxxxxxxxxx"
+	nodeOldBaker  = "tz1OldBakerxxxxxxxxxxxxxxxxxxxxxxxxx"
+	nodeFailed    = "tz1FailedDelegatorxxxxxxxxxxxxxxxxx"
+)
+
+var nodeGenesis = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Add(-5000000 * 10 * time.Second)
+
+// fakeNode serves the block RPC of a node from the blocks recorded in
+// testdata/node. Headers of other levels are synthesized, one block every
+// ten seconds.
+type fakeNode struct {
+	t      *testing.T
+	head   int64
+	blocks map[int64][]byte
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newFakeNode(t *testing.T) (*fakeNode, *httptest.Server) {
+	files, err := filepath.Glob("testdata/node/block_*.json")
+	require.NoError(t, err)
+	n := &fakeNode{t: t, head: 5000002, blocks: make(map[int64][]byte), requests: make(map[string]int)}
+	for _, f := range files {
+		level, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "block_"), ".json"), 10, 64)
+		require.NoError(t, err)
+		n.blocks[level], err = os.ReadFile(f)
+		require.NoError(t, err)
+	}
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return n, srv
+}
+
+// nodeContext holds the context values the fake node knows, by path below
+// /chains/main/blocks/.
+var nodeContext = map[string]string{
+	"5000000/context/contracts/" + nodeDelegator + "/balance":  `"1500000"`,
+	"5000000/context/contracts/" + nodeContract + "/balance":   `"42"`,
+	"5000000/context/contracts/" + nodeFailed + "/balance":     `"7"`,
+	"4999999/context/contracts/" + nodeContract + "/delegate":  `"` + nodeOldBaker + `"`,
+	"5000002/context/contracts/" + nodeDelegator + "/balance":  `"1499600"`,
+	"5000001/context/contracts/" + nodeDelegator + "/delegate": `"` + nodeBaker + `"`,
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/chains/main/blocks/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	n.mu.Lock()
+	n.requests[path]++
+	n.mu.Unlock()
+
+	if value, ok := nodeContext[path]; ok {
+		_, _ = w.Write([]byte(value))
+		return
+	}
+
+	id, rest, _ := strings.Cut(path, "/")
+	level := n.head
+	if id != "head" {
+		var err error
+		level, err = strconv.ParseInt(id, 10, 64)
+		require.NoError(n.t, err)
+	}
+	if level > n.head {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch rest {
+	case "":
+		block, ok := n.blocks[level]
+		if !ok {
+			_, _ = fmt.Fprintf(w, `{"hash":"BL%d","header":{"level":%d,"timestamp":%q},"operations":[[],[],[],[]]}`,
+				level, level, nodeGenesis.Add(time.Duration(level)*10*time.Second).Format(time.RFC3339))
+			return
+		}
+		_, _ = w.Write(block)
+	case "header":
+		hash := fmt.Sprintf("BL%d", level)
+		if block, ok := n.blocks[level]; ok {
+			var b struct {
+				Hash string `json:"hash"`
+			}
+			require.NoError(n.t, json.Unmarshal(block, &b))
+			hash = b.Hash
+		}
+		_, _ = fmt.Fprintf(w, `{"hash":%q,"level":%d,"timestamp":%q}`,
+			hash, level, nodeGenesis.Add(time.Duration(level)*10*time.Second).Format(time.RFC3339))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (n *fakeNode) count(path string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.requests[path]
+}
+
+func TestNodeClient_FetchDelegationsAtLevel(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	got, err := c.FetchDelegationsAtLevel(context.Background(), 5000000)
+	require.NoError(t, err)
+	require.Len(t, got, 3, "other operations are skipped")
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, int64(5000000*NodeIDStride+3), got[0].ID)
+	require.Equal(t, int64(5000000), got[0].Level)
+	require.Equal(t, "BLockHashAtLevel5000000xxxxxxxxxxxxxxxxxxxxxxxxxxx", got[0].Block)
+	require.True(t, ts.Equal(got[0].Timestamp))
+	require.Equal(t, int64(1500000), got[0].Amount)
+	require.Equal(t, nodeDelegator, got[0].Sender.Address)
+	require.Equal(t, &Account{Address: nodeBaker}, got[0].NewDelegate)
+	require.Nil(t, got[0].PrevDelegate, "no delegate before the first delegation")
+	require.Equal(t, "applied", got[0].Status)
+	require.Empty(t, got[0].Errors)
+
+	// Failed delegation to an address that is not a baker.
+	require.Equal(t, int64(5000000*NodeIDStride+4), got[1].ID)
+	require.Equal(t, nodeFailed, got[1].Sender.Address)
+	require.Equal(t, "failed", got[1].Status)
+	require.Equal(t, []OperationError{{Type: "contract.manager.unregistered_delegate"}}, got[1].Errors)
+
+	// Delegation emitted by a contract call.
+	require.Equal(t, int64(5000000*NodeIDStride+6), got[2].ID)
+	require.Equal(t, int64(42), got[2].Amount)
+	require.Equal(t, nodeContract, got[2].Sender.Address)
+	require.Nil(t, got[2].NewDelegate)
+	require.Equal(t, &Account{Address: nodeOldBaker}, got[2].PrevDelegate)
+}
+
+func TestNodeClient_FetchDelegationsAfterID(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	got, err := c.FetchDelegationsAfterID(context.Background(), 5000000*NodeIDStride+3, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.Equal(t, int64(5000000*NodeIDStride+4), got[0].ID)
+	require.Equal(t, int64(5000000*NodeIDStride+6), got[1].ID)
+	require.Equal(t, int64(5000002*NodeIDStride+1), got[2].ID)
+	require.Nil(t, got[2].NewDelegate, "undelegation")
+	require.Equal(t, &Account{Address: nodeBaker}, got[2].PrevDelegate)
+	require.Equal(t, int64(1499600), got[2].Amount)
+
+	got, err = c.FetchDelegationsAfterID(context.Background(), 5000000*NodeIDStride+4, 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, int64(5000000*NodeIDStride+6), got[0].ID)
+}
+
+func TestNodeClient_ResumesScanAtHead(t *testing.T) {
+	node, srv := newFakeNode(t)
+	node.head = 5000030
+	c := NewNodeClient(srv.URL, 5*time.Second)
+	ctx := context.Background()
+
+	after := int64(5000002*NodeIDStride + 1)
+	got, err := c.FetchDelegationsAfterID(ctx, after, 10)
+	require.NoError(t, err)
+	require.Empty(t, got)
+	require.Equal(t, 1, node.count("5000010"))
+	require.Equal(t, 1, node.count("5000025"))
+
+	// The next poll only rescans the last levels instead of the whole range.
+	_, err = c.FetchDelegationsAfterID(ctx, after, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, node.count("5000010"), "scanned levels are not read again")
+	require.Equal(t, 2, node.count("5000025"))
+}
+
+func TestNodeClient_FetchDelegationsInRange(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	got, err := c.FetchDelegationsInRange(context.Background(), 5000000, 5000002, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	for _, d := range got {
+		require.Equal(t, int64(5000000), d.Level)
+	}
+}
+
+func TestNodeClient_FetchDelegationsSince(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	since := time.Date(2024, 3, 1, 12, 0, 5, 0, time.UTC)
+	got, err := c.FetchDelegations(context.Background(), since, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, int64(5000002), got[0].Level)
+}
+
+func TestNodeClient_FetchHeadAndBlocks(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	head, err := c.FetchHead(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(5000002), head.Level)
+	require.Equal(t, "BLockHashAtLevel5000002xxxxxxxxxxxxxxxxxxxxxxxxxxx", head.Hash)
+
+	blocks, err := c.FetchBlocks(context.Background(), 5000000, 10)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3, "stops at the head")
+	require.Equal(t, int64(5000000), blocks[0].Level)
+	require.Equal(t, "BLockHashAtLevel5000000xxxxxxxxxxxxxxxxxxxxxxxxxxx", blocks[0].Hash)
+	require.Equal(t, "BLockHashAtLevel5000001xxxxxxxxxxxxxxxxxxxxxxxxxxx", blocks[1].Hash)
+}
+
+func TestNodeClient_StakingUnsupported(t *testing.T) {
+	_, srv := newFakeNode(t)
+	c := NewNodeClient(srv.URL, 5*time.Second)
+
+	_, err := c.FetchStakingAfterID(context.Background(), 0, 5000002, 10)
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+}
@@ -0,0 +1,47 @@
+package tzkt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Staking actions reported by TzKT since the Paris protocol.
+const (
+	StakingStake    = "stake"
+	StakingUnstake  = "unstake"
+	StakingFinalize = "finalize"
+)
+
+// StakingOperation is a stake, unstake or finalize operation: a delegator
+// moving tez into or out of its baker's stake.
+type StakingOperation struct {
+	ID        int64     `json:"id"`
+	Level     int64     `json:"level"`
+	Block     string    `json:"block"`
+	Timestamp time.Time `json:"timestamp"`
+	Sender    struct {
+		Address string `json:"address"`
+	} `json:"sender"`
+	// Baker is the baker the stake is delegated to.
+	Baker  *Account `json:"baker"`
+	Action string   `json:"action"`
+	// Amount is the amount actually staked, unstaked or finalized, in mutez.
+	Amount int64 `json:"amount"`
+}
+
+func (c *client) FetchStakingAfterID(ctx context.Context, afterID, maxLevel int64, limit int) ([]StakingOperation, error) {
+	q := url.Values{}
+	q.Set("id.gt", fmt.Sprintf("%d", afterID))
+	q.Set("level.le", fmt.Sprintf("%d", maxLevel))
+	q.Set("status", "applied")
+	q.Set("sort.asc", "id")
+	q.Set("limit", fmt.Sprintf("%d", limit))
+
+	var out []StakingOperation
+	if err := c.get(ctx, "/operations/staking", q, decodeInto(&out)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package tzkt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchStakingAfterID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/operations/staking", r.URL.Path)
+		q := r.URL.Query()
+		require.Equal(t, "7", q.Get("id.gt"))
+		require.Equal(t, "5726300", q.Get("level.le"))
+		require.Equal(t, "applied", q.Get("status"))
+		require.Equal(t, "id", q.Get("sort.asc"))
+		require.Equal(t, "10", q.Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{
+				"type": "staking",
+				"id": 8,
+				"level": 5726210,
+				"timestamp": "2024-06-19T09:00:00Z",
+				"block": "BLstake",
+				"sender": { "address": "tz1staker" },
+				"baker": { "alias": "Baker", "address": "tz1baker" },
+				"action": "stake",
+				"requestedAmount": 2000000,
+				"amount": 2000000,
+				"status": "applied"
+			}
+		]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, 2*time.Second)
+	ops, err := c.FetchStakingAfterID(context.Background(), 7, 5726300, 10)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, int64(8), ops[0].ID)
+	require.Equal(t, int64(5726210), ops[0].Level)
+	require.Equal(t, "tz1staker", ops[0].Sender.Address)
+	require.Equal(t, &Account{Address: "tz1baker", Alias: "Baker"}, ops[0].Baker)
+	require.Equal(t, StakingStake, ops[0].Action)
+	require.Equal(t, int64(2000000), ops[0].Amount)
+}
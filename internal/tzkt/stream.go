@@ -0,0 +1,350 @@
+package tzkt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event types pushed by the TzKT events hub on the operations channel.
+const (
+	// EventState is sent once after subscribing; State is the level TzKT is synced to.
+	EventState = 0
+	// EventData carries new operations; State is the level they were applied at.
+	EventData = 1
+	// EventReorg reports that TzKT reverted the chain; State is the level it reverted to.
+	EventReorg = 2
+)
+
+// Event is a message received on the operations channel.
+type Event struct {
+	Type        int
+	State       int64
+	Delegations []Delegation
+}
+
+// Subscriber streams delegations from the TzKT events hub.
+type Subscriber interface {
+	// Subscribe connects to the hub, subscribes to delegations and calls handle
+	// for every event until ctx is done, handle fails or the connection drops.
+	// It always returns a non-nil error.
+	Subscribe(ctx context.Context, handle func(Event) error) error
+}
+
+var errIdleTimeout = errors.New("no message from the hub within the idle timeout")
+
+// recordSeparator terminates every SignalR JSON protocol message.
+const recordSeparator = '\x1e'
+
+// SignalR message types used by the hub protocol.
+const (
+	messageInvocation = 1
+	messageCompletion = 3
+	messagePing       = 6
+	messageClose      = 7
+)
+
+type subscriber struct {
+	hubURL       string
+	http         *http.Client
+	pingInterval time.Duration
+	idleTimeout  time.Duration
+}
+
+// NewSubscriber returns a Subscriber for the events hub of the TzKT API at
+// baseURL. It uses SignalR's Server-Sent Events transport, which only needs
+// plain HTTP.
+func NewSubscriber(baseURL string) Subscriber {
+	if baseURL == "" {
+		baseURL = "https://api.tzkt.io/v1"
+	}
+	return &subscriber{
+		hubURL: strings.TrimSuffix(baseURL, "/") + "/ws",
+		// No client timeout: the event stream stays open indefinitely and
+		// liveness is tracked with idleTimeout instead.
+		http:         &http.Client{},
+		pingInterval: 15 * time.Second,
+		idleTimeout:  45 * time.Second,
+	}
+}
+
+type negotiateResponse struct {
+	ConnectionToken     string `json:"connectionToken"`
+	ConnectionID        string `json:"connectionId"`
+	AvailableTransports []struct {
+		Transport string `json:"transport"`
+	} `json:"availableTransports"`
+	Error string `json:"error"`
+}
+
+type hubMessage struct {
+	Type         int               `json:"type"`
+	Target       string            `json:"target,omitempty"`
+	InvocationID string            `json:"invocationId,omitempty"`
+	Arguments    []json.RawMessage `json:"arguments,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+type operationsMessage struct {
+	Type  int             `json:"type"`
+	State int64           `json:"state"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// operation is the subset of an operation needed to pick delegations out of
+// a mixed operations payload.
+type operation struct {
+	Type string `json:"type"`
+}
+
+func (s *subscriber) Subscribe(ctx context.Context, handle func(Event) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	token, err := s.negotiate(ctx)
+	if err != nil {
+		return fmt.Errorf("negotiate: %w", err)
+	}
+	connURL := s.hubURL + "?id=" + url.QueryEscape(token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, connURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("open event stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("open event stream: unexpected status %d", resp.StatusCode)
+	}
+
+	if err := s.send(ctx, connURL, map[string]any{"protocol": "json", "version": 1}); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+
+	// The hub drops clients that stay silent, and a half-open connection
+	// would block reads forever, so ping on a timer and give up when the
+	// server has been quiet for too long.
+	idle := time.AfterFunc(s.idleTimeout, func() { cancel(errIdleTimeout) })
+	defer idle.Stop()
+	go s.ping(ctx, connURL)
+
+	handshaken := false
+	events := newEventReader(resp.Body)
+	for {
+		payload, err := events.next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("event stream: %w", context.Cause(ctx))
+			}
+			return fmt.Errorf("event stream: %w", err)
+		}
+		idle.Reset(s.idleTimeout)
+
+		for _, record := range bytes.Split(payload, []byte{recordSeparator}) {
+			if len(bytes.TrimSpace(record)) == 0 {
+				continue
+			}
+			var msg hubMessage
+			if err := json.Unmarshal(record, &msg); err != nil {
+				return fmt.Errorf("decode hub message: %w", err)
+			}
+
+			if !handshaken {
+				if msg.Error != "" {
+					return fmt.Errorf("handshake: %s", msg.Error)
+				}
+				handshaken = true
+				if err := s.send(ctx, connURL, hubMessage{
+					Type:         messageInvocation,
+					Target:       "SubscribeToOperations",
+					InvocationID: "1",
+					Arguments:    []json.RawMessage{json.RawMessage(`{"types":"delegation"}`)},
+				}); err != nil {
+					return fmt.Errorf("subscribe: %w", err)
+				}
+				continue
+			}
+
+			switch msg.Type {
+			case messageInvocation:
+				if msg.Target != "operations" || len(msg.Arguments) == 0 {
+					continue
+				}
+				ev, err := decodeOperations(msg.Arguments[0])
+				if err != nil {
+					return err
+				}
+				// Handling may take a while (e.g. catching up on a gap), which
+				// says nothing about the health of the connection.
+				idle.Stop()
+				if err := handle(ev); err != nil {
+					return err
+				}
+				idle.Reset(s.idleTimeout)
+			case messageCompletion:
+				if msg.Error != "" {
+					return fmt.Errorf("subscribe: %s", msg.Error)
+				}
+			case messageClose:
+				if msg.Error != "" {
+					return fmt.Errorf("hub closed the connection: %s", msg.Error)
+				}
+				return errors.New("hub closed the connection")
+			}
+		}
+	}
+}
+
+func (s *subscriber) negotiate(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.hubURL+"/negotiate?negotiateVersion=1", nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var out negotiateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if out.Error != "" {
+		return "", errors.New(out.Error)
+	}
+	for _, t := range out.AvailableTransports {
+		if t.Transport == "ServerSentEvents" {
+			if out.ConnectionToken != "" {
+				return out.ConnectionToken, nil
+			}
+			return out.ConnectionID, nil
+		}
+	}
+	return "", errors.New("hub does not offer the ServerSentEvents transport")
+}
+
+// send posts a single hub protocol message on the connection.
+func (s *subscriber) send(ctx context.Context, connURL string, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+	body = append(body, recordSeparator)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, connURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *subscriber) ping(ctx context.Context, connURL string) {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// A failed ping surfaces as an idle timeout on the stream.
+			_ = s.send(ctx, connURL, hubMessage{Type: messagePing})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func decodeOperations(raw json.RawMessage) (Event, error) {
+	var msg operationsMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return Event{}, fmt.Errorf("decode operations message: %w", err)
+	}
+	ev := Event{Type: msg.Type, State: msg.State}
+	if msg.Type != EventData || len(msg.Data) == 0 {
+		return ev, nil
+	}
+
+	var ops []json.RawMessage
+	if err := json.Unmarshal(msg.Data, &ops); err != nil {
+		return Event{}, fmt.Errorf("decode operations: %w", err)
+	}
+	for _, op := range ops {
+		var kind operation
+		if err := json.Unmarshal(op, &kind); err != nil {
+			return Event{}, fmt.Errorf("decode operation: %w", err)
+		}
+		if kind.Type != "delegation" {
+			continue
+		}
+		var d Delegation
+		if err := json.Unmarshal(op, &d); err != nil {
+			return Event{}, fmt.Errorf("decode delegation: %w", err)
+		}
+		ev.Delegations = append(ev.Delegations, d)
+	}
+	return ev, nil
+}
+
+// eventReader reads the data of Server-Sent Events from a stream.
+type eventReader struct {
+	r *bufio.Reader
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{r: bufio.NewReader(r)}
+}
+
+// next returns the data of the next event, joining multi-line data with newlines.
+func (e *eventReader) next() ([]byte, error) {
+	var data []byte
+	hasData := false
+	for {
+		line, err := e.r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF && hasData {
+				return data, nil
+			}
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+
+		if len(line) == 0 {
+			if hasData {
+				return data, nil
+			}
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			value = bytes.TrimPrefix(value, []byte(" "))
+			if hasData {
+				data = append(data, '\n')
+			}
+			data = append(data, value...)
+			hasData = true
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHub is a minimal SignalR hub speaking the JSON protocol over Server-Sent Events.
+type fakeHub struct {
+	t *testing.T
+
+	mu          sync.Mutex
+	connections int
+	streams     map[string]chan string
+	subscribed  chan string
+}
+
+func newFakeHub(t *testing.T) (*fakeHub, *httptest.Server) {
+	h := &fakeHub{t: t, streams: make(map[string]chan string), subscribed: make(chan string, 10)}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/ws/negotiate":
+		h.mu.Lock()
+		h.connections++
+		token := fmt.Sprintf("conn-%d", h.connections)
+		h.streams[token] = make(chan string, 10)
+		h.mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"negotiateVersion":1,"connectionId":"id","connectionToken":%q,
+			"availableTransports":[{"transport":"WebSockets"},{"transport":"ServerSentEvents"}]}`, token)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/ws":
+		stream := h.stream(r.URL.Query().Get("id"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case msg, ok := <-stream:
+				if !ok {
+					return
+				}
+				// Multi-line payloads are split across data fields, as SignalR does.
+				_, _ = fmt.Fprintf(w, "data: %s\x1e\n\n", strings.ReplaceAll(msg, "\n", "\ndata: "))
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+	case r.Method == http.MethodPost && r.URL.Path == "/ws":
+		token := r.URL.Query().Get("id")
+		body, _ := io.ReadAll(r.Body)
+		for _, record := range strings.Split(string(body), "\x1e") {
+			if record == "" {
+				continue
+			}
+			var msg map[string]any
+			require.NoError(h.t, json.Unmarshal([]byte(record), &msg))
+			switch {
+			case msg["protocol"] == "json":
+				h.stream(token) <- `{}`
+			case msg["target"] == "SubscribeToOperations":
+				args, _ := json.Marshal(msg["arguments"])
+				h.stream(token) <- fmt.Sprintf(`{"type":3,"invocationId":%q}`, msg["invocationId"])
+				h.stream(token) <- `{"type":1,"target":"operations","arguments":[{"type":0,"state":100}]}`
+				h.subscribed <- string(args)
+			}
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *fakeHub) stream(token string) chan string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream, ok := h.streams[token]
+	require.True(h.t, ok, "unknown connection %q", token)
+	return stream
+}
+
+func (h *fakeHub) latest() chan string {
+	h.mu.Lock()
+	token := fmt.Sprintf("conn-%d", h.connections)
+	h.mu.Unlock()
+	return h.stream(token)
+}
+
+// push sends a message on the most recent connection.
+func (h *fakeHub) push(msg string) {
+	h.latest() <- msg
+}
+
+// disconnect ends the event stream of the most recent connection.
+func (h *fakeHub) disconnect() {
+	close(h.latest())
+}
+
+var errStop = errors.New("stop")
+
+func TestSubscribe_ConnectsAndReceivesDelegations(t *testing.T) {
+	hub, srv := newFakeHub(t)
+
+	var events []Event
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewSubscriber(srv.URL).Subscribe(ctx, func(ev Event) error {
+			events = append(events, ev)
+			if ev.Type == EventData {
+				return errStop
+			}
+			return nil
+		})
+	}()
+
+	require.JSONEq(t, `[{"types":"delegation"}]`, <-hub.subscribed)
+	hub.push(`{"type":6}`)
+	hub.push(`{"type":1,"target":"operations","arguments":[{"type":1,"state":101,"data":[
+		{"type":"transaction","id":10},
+		{"type":"delegation","id":11,"level":101,"block":"BLx","timestamp":"2024-01-01T00:00:00Z",
+		 "amount":5,"sender":{"address":"tz1abc"},"newDelegate":{"address":"tz1baker"}}
+	]}]}`)
+
+	require.ErrorIs(t, <-done, errStop)
+	require.Len(t, events, 2)
+	require.Equal(t, Event{Type: EventState, State: 100}, events[0])
+	require.Equal(t, EventData, events[1].Type)
+	require.Equal(t, int64(101), events[1].State)
+	require.Len(t, events[1].Delegations, 1)
+	require.Equal(t, int64(11), events[1].Delegations[0].ID)
+	require.Equal(t, "tz1abc", events[1].Delegations[0].Sender.Address)
+	require.Equal(t, "tz1baker", events[1].Delegations[0].NewDelegate.Address)
+}
+
+func TestSubscribe_ReturnsOnDisconnectAndReconnects(t *testing.T) {
+	hub, srv := newFakeHub(t)
+	sub := NewSubscriber(srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 1; i <= 2; i++ {
+		states := make(chan int64, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- sub.Subscribe(ctx, func(ev Event) error {
+				states <- ev.State
+				return nil
+			})
+		}()
+
+		<-hub.subscribed
+		require.Equal(t, int64(100), <-states)
+		hub.disconnect()
+
+		err := <-done
+		require.Error(t, err)
+		require.NotErrorIs(t, err, context.DeadlineExceeded)
+		hub.mu.Lock()
+		require.Equal(t, i, hub.connections)
+		hub.mu.Unlock()
+	}
+}
+
+func TestSubscribe_ReportsHubClose(t *testing.T) {
+	hub, srv := newFakeHub(t)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewSubscriber(srv.URL).Subscribe(context.Background(), func(Event) error { return nil })
+	}()
+
+	<-hub.subscribed
+	hub.push(`{"type":7,"error":"server shutting down"}`)
+	require.ErrorContains(t, <-done, "server shutting down")
+}
+
+func TestSubscribe_IdleTimeout(t *testing.T) {
+	hub, srv := newFakeHub(t)
+	sub := NewSubscriber(srv.URL).(*subscriber)
+	sub.idleTimeout = 50 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Subscribe(context.Background(), func(Event) error { return nil })
+	}()
+
+	<-hub.subscribed
+	require.ErrorIs(t, <-done, errIdleTimeout)
+}
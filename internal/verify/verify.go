@@ -0,0 +1,239 @@
+// Package verify checks stored delegations against a second source, another
+// TzKT instance or a Tezos node, so that the table is known to match the
+// chain rather than a single indexer.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+// pageSize is the number of delegations fetched from the source per request.
+const pageSize = 10000
+
+// Mismatch kinds.
+const (
+	// KindMissing is a delegation of the source that is not stored.
+	KindMissing = "missing"
+	// KindUnexpected is a stored delegation the source does not have.
+	KindUnexpected = "unexpected"
+	// KindDifferent is a delegation stored with another id, amount or status.
+	KindDifferent = "different"
+)
+
+// Config configures a Verifier.
+type Config struct {
+	Network string
+	Store   store.AuditStore
+	// Source is the second source the stored delegations are checked against.
+	Source tzkt.Client
+	// CompareIDs compares operation ids. Only a TzKT source numbers
+	// operations like the stored rows; node ids are synthetic.
+	CompareIDs bool
+	// Samples is the number of level ranges checked by a run, each of
+	// RangeSize levels.
+	Samples   int
+	RangeSize int64
+	// Confirmations leaves the most recent levels out of the samples, as they
+	// may still be reorganized.
+	Confirmations int64
+}
+
+// Verifier compares random level ranges of the delegations table with a
+// second source.
+type Verifier struct {
+	cfg Config
+}
+
+// New returns a Verifier, defaulting to 5 samples of 100 levels.
+func New(cfg Config) *Verifier {
+	if cfg.Samples <= 0 {
+		cfg.Samples = 5
+	}
+	if cfg.RangeSize <= 0 {
+		cfg.RangeSize = 100
+	}
+	return &Verifier{cfg: cfg}
+}
+
+// Operation is a delegation as seen by one side of a comparison.
+type Operation struct {
+	ID     int64  `json:"id"`
+	Amount int64  `json:"amount"`
+	Status string `json:"status"`
+}
+
+// Mismatch is a delegation on which the table and the source disagree.
+// Delegations are matched by level and delegator.
+type Mismatch struct {
+	Kind      string     `json:"kind"`
+	Level     int64      `json:"level"`
+	Delegator string     `json:"delegator"`
+	Stored    *Operation `json:"stored,omitempty"`
+	Source    *Operation `json:"source,omitempty"`
+}
+
+// Range is a level range [FromLevel, ToLevel) that was checked.
+type Range struct {
+	FromLevel int64 `json:"from_level"`
+	ToLevel   int64 `json:"to_level"`
+	Stored    int   `json:"stored"`
+	Source    int   `json:"source"`
+}
+
+// Report is the outcome of a verification run.
+type Report struct {
+	Network    string     `json:"network"`
+	StartedAt  time.Time  `json:"started_at"`
+	Ranges     []Range    `json:"ranges"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// OK reports whether the table matched the source on every range checked.
+func (r Report) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// Verify checks samples random level ranges, or the configured number of
+// samples when samples is not positive. The ranges are drawn between the
+// first stored level and the last confirmed one.
+func (v *Verifier) Verify(ctx context.Context, samples int) (Report, error) {
+	if samples <= 0 {
+		samples = v.cfg.Samples
+	}
+	from, to, err := v.cfg.Store.LevelBounds(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("level bounds: %w", err)
+	}
+	to -= v.cfg.Confirmations
+
+	var ranges [][2]int64
+	if to > 0 && to >= from {
+		for range samples {
+			start := from
+			if span := to - from - v.cfg.RangeSize; span > 0 {
+				start += rand.Int64N(span + 1)
+			}
+			ranges = append(ranges, [2]int64{start, min(start+v.cfg.RangeSize, to+1)})
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	}
+	return v.VerifyRanges(ctx, ranges...)
+}
+
+// VerifyRanges checks the given level ranges [from, to).
+func (v *Verifier) VerifyRanges(ctx context.Context, ranges ...[2]int64) (Report, error) {
+	report := Report{
+		Network:    v.cfg.Network,
+		StartedAt:  time.Now().UTC(),
+		Ranges:     []Range{},
+		Mismatches: []Mismatch{},
+	}
+	for _, r := range ranges {
+		stored, err := v.cfg.Store.GetDelegationsInRange(ctx, r[0], r[1])
+		if err != nil {
+			return Report{}, fmt.Errorf("stored delegations in [%d, %d): %w", r[0], r[1], err)
+		}
+		source, err := v.fetch(ctx, r[0], r[1])
+		if err != nil {
+			return Report{}, fmt.Errorf("source delegations in [%d, %d): %w", r[0], r[1], err)
+		}
+		report.Ranges = append(report.Ranges, Range{FromLevel: r[0], ToLevel: r[1], Stored: len(stored), Source: len(source)})
+		report.Mismatches = append(report.Mismatches, v.diff(stored, source)...)
+	}
+	return report, nil
+}
+
+// fetch reads every delegation of the source in [from, to), leaving out
+// those without a sender, which the poller never stores.
+func (v *Verifier) fetch(ctx context.Context, from, to int64) ([]tzkt.Delegation, error) {
+	var (
+		out     []tzkt.Delegation
+		afterID int64
+	)
+	for {
+		page, err := v.cfg.Source.FetchDelegationsInRange(ctx, from, to, afterID, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range page {
+			if d.Sender.Address != "" {
+				out = append(out, d)
+			}
+		}
+		if len(page) < pageSize {
+			return out, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+}
+
+type key struct {
+	level     int64
+	delegator string
+}
+
+// diff matches delegations by level and delegator, in id order when an
+// account delegated more than once in a block, and reports those that are
+// missing on either side or differ.
+func (v *Verifier) diff(stored []store.StoredDelegation, source []tzkt.Delegation) []Mismatch {
+	bySource := make(map[key][]tzkt.Delegation)
+	for _, d := range source {
+		k := key{d.Level, d.Sender.Address}
+		bySource[k] = append(bySource[k], d)
+	}
+
+	var out []Mismatch
+	for _, s := range stored {
+		k := key{s.Level, s.Delegator}
+		storedOp := &Operation{ID: s.TzktID, Amount: s.Amount, Status: s.Status}
+		candidates := bySource[k]
+		if len(candidates) == 0 {
+			out = append(out, Mismatch{Kind: KindUnexpected, Level: s.Level, Delegator: s.Delegator, Stored: storedOp})
+			continue
+		}
+		d := candidates[0]
+		bySource[k] = candidates[1:]
+
+		sourceOp := &Operation{ID: d.ID, Amount: d.Amount, Status: d.Status}
+		if (v.cfg.CompareIDs && s.TzktID != d.ID) || s.Amount != d.Amount || s.Status != d.Status {
+			out = append(out, Mismatch{Kind: KindDifferent, Level: s.Level, Delegator: s.Delegator, Stored: storedOp, Source: sourceOp})
+		}
+	}
+
+	// What is left was not matched by a stored delegation, listed in source order.
+	for _, d := range source {
+		k := key{d.Level, d.Sender.Address}
+		left := bySource[k]
+		if len(left) == 0 || left[0].ID != d.ID {
+			continue
+		}
+		bySource[k] = left[1:]
+		out = append(out, Mismatch{
+			Kind:      KindMissing,
+			Level:     d.Level,
+			Delegator: d.Sender.Address,
+			Source:    &Operation{ID: d.ID, Amount: d.Amount, Status: d.Status},
+		})
+	}
+	return out
+}
+
+// NewSource returns a client of the second source: a TzKT instance at url
+// when source is "tzkt", or the RPC of a Tezos node when it is "node".
+func NewSource(source, url string, timeout time.Duration) (tzkt.Client, error) {
+	switch source {
+	case "tzkt":
+		return tzkt.NewClient(url, timeout), nil
+	case "node":
+		return tzkt.NewNodeClient(url, timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown verification source %q, expected tzkt or node", source)
+	}
+}
@@ -0,0 +1,162 @@
+package verify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tezos-delegation-service/internal/store"
+	"tezos-delegation-service/internal/tzkt"
+)
+
+type fakeStore struct {
+	rows []store.StoredDelegation
+}
+
+func (s *fakeStore) LevelBounds(context.Context) (int64, int64, error) {
+	if len(s.rows) == 0 {
+		return 0, 0, nil
+	}
+	return s.rows[0].Level, s.rows[len(s.rows)-1].Level, nil
+}
+
+func (s *fakeStore) GetDelegationsInRange(_ context.Context, from, to int64) ([]store.StoredDelegation, error) {
+	var out []store.StoredDelegation
+	for _, r := range s.rows {
+		if r.Level >= from && r.Level < to {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) CountInRange(ctx context.Context, from, to int64) (int, error) {
+	rows, _ := s.GetDelegationsInRange(ctx, from, to)
+	return len(rows), nil
+}
+
+func (s *fakeStore) SaveReconciliation(context.Context, store.Reconciliation) error {
+	return nil
+}
+
+// fakeSource serves delegations by level range, one per page to exercise paging.
+type fakeSource struct {
+	tzkt.Client
+	delegations []tzkt.Delegation
+	calls       int
+}
+
+func (s *fakeSource) FetchDelegationsInRange(_ context.Context, from, to, afterID int64, limit int) ([]tzkt.Delegation, error) {
+	s.calls++
+	var out []tzkt.Delegation
+	for _, d := range s.delegations {
+		if d.Level >= from && d.Level < to && d.ID > afterID && len(out) < limit {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func delegation(id, level int64, sender string, amount int64) tzkt.Delegation {
+	d := tzkt.Delegation{ID: id, Level: level, Amount: amount, Status: "applied"}
+	d.Sender.Address = sender
+	return d
+}
+
+func TestVerifyRanges_ReportsMismatches(t *testing.T) {
+	st := &fakeStore{rows: []store.StoredDelegation{
+		{TzktID: 1, Level: 10, Delegator: "tz1same", Amount: 100, Status: "applied"},
+		{TzktID: 2, Level: 11, Delegator: "tz1amount", Amount: 200, Status: "applied"},
+		{TzktID: 3, Level: 12, Delegator: "tz1extra", Amount: 300, Status: "applied"},
+		{TzktID: 9, Level: 13, Delegator: "tz1id", Amount: 400, Status: "applied"},
+	}}
+	src := &fakeSource{delegations: []tzkt.Delegation{
+		delegation(1, 10, "tz1same", 100),
+		delegation(2, 11, "tz1amount", 250),
+		delegation(4, 13, "tz1id", 400),
+		delegation(5, 14, "tz1missing", 500),
+	}}
+
+	v := New(Config{Network: "mainnet", Store: st, Source: src, CompareIDs: true})
+	report, err := v.VerifyRanges(context.Background(), [2]int64{10, 15})
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, []Range{{FromLevel: 10, ToLevel: 15, Stored: 4, Source: 4}}, report.Ranges)
+	require.Equal(t, []Mismatch{
+		{Kind: KindDifferent, Level: 11, Delegator: "tz1amount",
+			Stored: &Operation{ID: 2, Amount: 200, Status: "applied"},
+			Source: &Operation{ID: 2, Amount: 250, Status: "applied"}},
+		{Kind: KindUnexpected, Level: 12, Delegator: "tz1extra",
+			Stored: &Operation{ID: 3, Amount: 300, Status: "applied"}},
+		{Kind: KindDifferent, Level: 13, Delegator: "tz1id",
+			Stored: &Operation{ID: 9, Amount: 400, Status: "applied"},
+			Source: &Operation{ID: 4, Amount: 400, Status: "applied"}},
+		{Kind: KindMissing, Level: 14, Delegator: "tz1missing",
+			Source: &Operation{ID: 5, Amount: 500, Status: "applied"}},
+	}, report.Mismatches)
+}
+
+func TestVerifyRanges_IgnoresIDsOfANode(t *testing.T) {
+	st := &fakeStore{rows: []store.StoredDelegation{
+		{TzktID: 7, Level: 10, Delegator: "tz1a", Amount: 100, Status: "applied"},
+		{TzktID: 8, Level: 10, Delegator: "tz1b", Amount: 100, Status: "failed"},
+	}}
+	src := &fakeSource{delegations: []tzkt.Delegation{
+		delegation(10*tzkt.NodeIDStride, 10, "tz1a", 100),
+		delegation(10*tzkt.NodeIDStride+1, 10, "tz1b", 100),
+	}}
+	src.delegations[1].Status = "failed"
+
+	report, err := New(Config{Store: st, Source: src}).VerifyRanges(context.Background(), [2]int64{10, 11})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report.Mismatches)
+}
+
+func TestVerifyRanges_SkipsSenderlessDelegations(t *testing.T) {
+	st := &fakeStore{rows: []store.StoredDelegation{
+		{TzktID: 1, Level: 10, Delegator: "tz1a", Amount: 100, Status: "applied"},
+	}}
+	src := &fakeSource{delegations: []tzkt.Delegation{
+		delegation(1, 10, "tz1a", 100),
+		delegation(2, 10, "", 0),
+	}}
+
+	report, err := New(Config{Store: st, Source: src}).VerifyRanges(context.Background(), [2]int64{10, 11})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report.Mismatches)
+	require.Equal(t, 1, report.Ranges[0].Source)
+}
+
+func TestVerify_SamplesConfirmedLevels(t *testing.T) {
+	st := &fakeStore{}
+	src := &fakeSource{}
+	for level := int64(1); level <= 1000; level++ {
+		st.rows = append(st.rows, store.StoredDelegation{TzktID: level, Level: level, Delegator: "tz1a", Amount: level, Status: "applied"})
+		src.delegations = append(src.delegations, delegation(level, level, "tz1a", level))
+	}
+
+	v := New(Config{Store: st, Source: src, CompareIDs: true, Samples: 3, RangeSize: 50, Confirmations: 10})
+	report, err := v.Verify(context.Background(), 0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Len(t, report.Ranges, 3)
+	for _, r := range report.Ranges {
+		require.Equal(t, int64(50), r.ToLevel-r.FromLevel)
+		require.GreaterOrEqual(t, r.FromLevel, int64(1))
+		require.LessOrEqual(t, r.ToLevel, int64(991), "unconfirmed levels are not sampled")
+		require.Equal(t, 50, r.Stored)
+		require.Equal(t, 50, r.Source)
+	}
+
+	report, err = v.Verify(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, report.Ranges, 1)
+}
+
+func TestVerify_EmptyTable(t *testing.T) {
+	report, err := New(Config{Store: &fakeStore{}, Source: &fakeSource{}}).Verify(context.Background(), 0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Empty(t, report.Ranges)
+}